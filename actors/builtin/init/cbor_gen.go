@@ -13,7 +13,7 @@ import (
 
 var _ = xerrors.Errorf
 
-var lengthBufState = []byte{131}
+var lengthBufState = []byte{132}
 
 func (t *State) MarshalCBOR(w io.Writer) error {
 	if t == nil {
@@ -32,6 +32,12 @@ func (t *State) MarshalCBOR(w io.Writer) error {
 		return xerrors.Errorf("failed to write cid field t.AddressMap: %w", err)
 	}
 
+	// t.RobustAddressMap (cid.Cid) (struct)
+
+	if err := cbg.WriteCidBuf(scratch, w, t.RobustAddressMap); err != nil {
+		return xerrors.Errorf("failed to write cid field t.RobustAddressMap: %w", err)
+	}
+
 	// t.NextID (abi.ActorID) (uint64)
 
 	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.NextID)); err != nil {
@@ -66,7 +72,7 @@ func (t *State) UnmarshalCBOR(r io.Reader) error {
 		return fmt.Errorf("cbor input should be of type array")
 	}
 
-	if extra != 3 {
+	if extra != 4 {
 		return fmt.Errorf("cbor input had wrong number of fields")
 	}
 
@@ -81,6 +87,18 @@ func (t *State) UnmarshalCBOR(r io.Reader) error {
 
 		t.AddressMap = c
 
+	}
+	// t.RobustAddressMap (cid.Cid) (struct)
+
+	{
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("failed to read cid field t.RobustAddressMap: %w", err)
+		}
+
+		t.RobustAddressMap = c
+
 	}
 	// t.NextID (abi.ActorID) (uint64)
 
@@ -1,6 +1,8 @@
 package init
 
 import (
+	"math"
+
 	addr "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	cid "github.com/ipfs/go-cid"
@@ -12,9 +14,10 @@ import (
 )
 
 type State struct {
-	AddressMap  cid.Cid // HAMT[addr.Address]abi.ActorID
-	NextID      abi.ActorID
-	NetworkName string
+	AddressMap       cid.Cid // HAMT[addr.Address]abi.ActorID
+	RobustAddressMap cid.Cid // HAMT[abi.ActorID]addr.Address, the inverse of AddressMap
+	NextID           abi.ActorID
+	NetworkName      string
 }
 
 func ConstructState(store adt.Store, networkName string) (*State, error) {
@@ -24,9 +27,10 @@ func ConstructState(store adt.Store, networkName string) (*State, error) {
 	}
 
 	return &State{
-		AddressMap:  emptyAddressMapCid,
-		NextID:      abi.ActorID(builtin.FirstNonSingletonActorId),
-		NetworkName: networkName,
+		AddressMap:       emptyAddressMapCid,
+		RobustAddressMap: emptyAddressMapCid,
+		NextID:           abi.ActorID(builtin.FirstNonSingletonActorId),
+		NetworkName:      networkName,
 	}, nil
 }
 
@@ -80,8 +84,105 @@ func (s *State) MapAddressToNewID(store adt.Store, address addr.Address) (addr.A
 	if err != nil {
 		return addr.Undef, xerrors.Errorf("failed to get address map root: %w", err)
 	}
+
+	rm, err := adt.AsMap(store, s.RobustAddressMap, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return addr.Undef, xerrors.Errorf("failed to load robust address map: %w", err)
+	}
+	err = rm.Put(abi.UIntKey(uint64(actorID)), &address)
+	if err != nil {
+		return addr.Undef, xerrors.Errorf("map address failed to store robust entry: %w", err)
+	}
+	rmr, err := rm.Root()
+	if err != nil {
+		return addr.Undef, xerrors.Errorf("failed to get robust address map root: %w", err)
+	}
 	s.AddressMap = amr
+	s.RobustAddressMap = rmr
 
 	idAddr, err := addr.NewIDAddress(uint64(actorID))
 	return idAddr, err
 }
+
+// Allocates a contiguous block of new ID addresses, mapping each of the argument addresses to one in turn.
+// The address maps are loaded and flushed just once. Returns the newly-allocated addresses, in argument order.
+// The addresses must be distinct and not already mapped. State is unchanged if an error is returned.
+func (s *State) MapAddressesToNewIDs(store adt.Store, addresses []addr.Address) ([]addr.Address, error) {
+	if uint64(len(addresses)) > math.MaxInt64-uint64(s.NextID) {
+		return nil, xerrors.Errorf("allocating %d IDs from %d would overflow", len(addresses), s.NextID)
+	}
+	m, err := adt.AsMap(store, s.AddressMap, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load address map: %w", err)
+	}
+
+	rm, err := adt.AsMap(store, s.RobustAddressMap, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load robust address map: %w", err)
+	}
+
+	entries := make([]adt.MapEntry, len(addresses))
+	robustEntries := make([]adt.MapEntry, len(addresses))
+	idAddrs := make([]addr.Address, len(addresses))
+	seen := make(map[addr.Address]struct{}, len(addresses))
+	for i, address := range addresses {
+		if _, ok := seen[address]; ok {
+			return nil, xerrors.Errorf("duplicate address %v in batch", address)
+		}
+		seen[address] = struct{}{}
+		// Re-mapping an address would orphan its previous ID in the robust address map.
+		if found, err := m.Has(abi.AddrKey(address)); err != nil {
+			return nil, xerrors.Errorf("failed to check for address %v: %w", address, err)
+		} else if found {
+			return nil, xerrors.Errorf("address %v is already mapped", address)
+		}
+
+		actorID := cbg.CborInt(uint64(s.NextID) + uint64(i))
+		entries[i] = adt.MapEntry{Key: abi.AddrKey(address), Value: &actorID}
+		robustEntries[i] = adt.MapEntry{Key: abi.UIntKey(uint64(actorID)), Value: &addresses[i]}
+		if idAddrs[i], err = addr.NewIDAddress(uint64(actorID)); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.PutBatch(entries); err != nil {
+		return nil, xerrors.Errorf("map addresses failed to store entries: %w", err)
+	}
+	if err := rm.PutBatch(robustEntries); err != nil {
+		return nil, xerrors.Errorf("map addresses failed to store robust entries: %w", err)
+	}
+	amr, err := m.Root()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get address map root: %w", err)
+	}
+	rmr, err := rm.Root()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get robust address map root: %w", err)
+	}
+	s.AddressMap = amr
+	s.RobustAddressMap = rmr
+	s.NextID += abi.ActorID(len(addresses))
+	return idAddrs, nil
+}
+
+// LookupRobust finds the non-ID address mapped to an ID address, if any.
+// Returns the address and `true` if found, or an undefined address and `false` if the ID is not mapped.
+func (s *State) LookupRobust(store adt.Store, idAddr addr.Address) (addr.Address, bool, error) {
+	actorID, err := addr.IDFromAddress(idAddr)
+	if err != nil {
+		return addr.Undef, false, xerrors.Errorf("failed to resolve ID from %v: %w", idAddr, err)
+	}
+	m, err := adt.AsMap(store, s.RobustAddressMap, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return addr.Undef, false, xerrors.Errorf("failed to load robust address map: %w", err)
+	}
+
+	var robust addr.Address
+	found, err := m.Get(abi.UIntKey(actorID), &robust)
+	if err != nil {
+		return addr.Undef, false, xerrors.Errorf("failed to get from robust address map: %w", err)
+	}
+	if !found {
+		return addr.Undef, false, nil
+	}
+	return robust, true, nil
+}
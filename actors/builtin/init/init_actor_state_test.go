@@ -0,0 +1,122 @@
+package init_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	addr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	init_ "github.com/filecoin-project/specs-actors/v5/actors/builtin/init"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestLookupRobust(t *testing.T) {
+	store := ipld.NewADTStore(context.Background())
+	st, err := init_.ConstructState(store, "test")
+	require.NoError(t, err)
+
+	robust := []addr.Address{
+		tutil.NewSECP256K1Addr(t, "a"),
+		tutil.NewBLSAddr(t, 1),
+		tutil.NewActorAddr(t, "c"),
+	}
+	var ids []addr.Address
+	for _, a := range robust {
+		id, err := st.MapAddressToNewID(store, a)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	for i, a := range robust {
+		resolved, found, err := st.ResolveAddress(store, a)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, ids[i], resolved)
+
+		reversed, found, err := st.LookupRobust(store, ids[i])
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, a, reversed)
+	}
+
+	// Unassigned IDs are not found.
+	_, found, err := st.LookupRobust(store, tutil.NewIDAddr(t, uint64(st.NextID)))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Only ID addresses may be looked up.
+	_, _, err = st.LookupRobust(store, robust[0])
+	assert.Error(t, err)
+}
+
+func TestMapAddressesToNewIDs(t *testing.T) {
+	store := ipld.NewADTStore(context.Background())
+	st, err := init_.ConstructState(store, "test")
+	require.NoError(t, err)
+
+	first, err := st.MapAddressToNewID(store, tutil.NewActorAddr(t, "first"))
+	require.NoError(t, err)
+	var batch []addr.Address
+	for _, s := range []string{"a", "b", "c", "d"} {
+		batch = append(batch, tutil.NewActorAddr(t, s))
+	}
+	nextID := st.NextID
+
+	ids, err := st.MapAddressesToNewIDs(store, batch)
+	require.NoError(t, err)
+	require.Len(t, ids, len(batch))
+	assert.Equal(t, nextID+abi.ActorID(len(batch)), st.NextID)
+
+	seen := map[addr.Address]bool{first: true}
+	for i, a := range batch {
+		assert.Equal(t, tutil.NewIDAddr(t, uint64(nextID)+uint64(i)), ids[i])
+		assert.False(t, seen[ids[i]])
+		seen[ids[i]] = true
+
+		resolved, found, err := st.ResolveAddress(store, a)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, ids[i], resolved)
+
+		reversed, found, err := st.LookupRobust(store, ids[i])
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, a, reversed)
+	}
+
+	// Subsequent single allocations continue from the batch.
+	next, err := st.MapAddressToNewID(store, tutil.NewActorAddr(t, "next"))
+	require.NoError(t, err)
+	assert.Equal(t, tutil.NewIDAddr(t, uint64(nextID)+uint64(len(batch))), next)
+
+	_, msgs := init_.CheckStateInvariants(st, store)
+	assert.True(t, msgs.IsEmpty(), strings.Join(msgs.Messages(), "\n"))
+
+	t.Run("rejected batches leave state unchanged", func(t *testing.T) {
+		before := *st
+		_, err := st.MapAddressesToNewIDs(store, []addr.Address{tutil.NewActorAddr(t, "x"), tutil.NewActorAddr(t, "x")})
+		assert.Error(t, err)
+		assert.Equal(t, before, *st)
+
+		// An address already mapped, whether singly or in a batch, can't be mapped again.
+		for _, mapped := range []addr.Address{tutil.NewActorAddr(t, "first"), batch[1]} {
+			_, err = st.MapAddressesToNewIDs(store, []addr.Address{tutil.NewActorAddr(t, "y"), mapped})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "already mapped")
+			assert.Equal(t, before, *st)
+		}
+
+		st.NextID = math.MaxInt64 - 1
+		_, err = st.MapAddressesToNewIDs(store, batch[:2])
+		assert.Error(t, err)
+		assert.Equal(t, before.AddressMap, st.AddressMap)
+		assert.Equal(t, before.RobustAddressMap, st.RobustAddressMap)
+		assert.Equal(t, abi.ActorID(math.MaxInt64-1), st.NextID)
+	})
+}
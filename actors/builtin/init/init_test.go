@@ -240,6 +240,7 @@ func (h *initHarness) constructAndVerify(rt *mock.Runtime) {
 	emptyMap, err := adt.AsMap(adt.AsStore(rt), st.AddressMap, builtin.DefaultHamtBitwidth)
 	assert.NoError(h.t, err)
 	assert.Equal(h.t, tutil.MustRoot(h.t, emptyMap), st.AddressMap)
+	assert.Equal(h.t, tutil.MustRoot(h.t, emptyMap), st.RobustAddressMap)
 	assert.Equal(h.t, abi.ActorID(builtin.FirstNonSingletonActorId), st.NextID)
 	assert.Equal(h.t, "mock", st.NetworkName)
 }
@@ -38,7 +38,7 @@ func CheckStateInvariants(st *State, store adt.Store) (*StateSummary, *builtin.M
 	var value cbg.CborInt
 	err = lut.ForEach(&value, func(key string) error {
 		actorId := abi.ActorID(value)
-		keyAddr, err := addr.NewFromBytes([]byte(key))
+		keyAddr, err := adt.ParseAddrKey(key)
 		if err != nil {
 			return err
 		}
@@ -55,5 +55,27 @@ func CheckStateInvariants(st *State, store adt.Store) (*StateSummary, *builtin.M
 		return nil
 	})
 	acc.RequireNoError(err, "error iterating address map")
+
+	robustLut, err := adt.AsMap(store, st.RobustAddressMap, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		acc.Addf("error loading robust address map: %v", err)
+		return initSummary, acc
+	}
+	robustCount := 0
+	var robustAddr addr.Address
+	err = robustLut.ForEach(&robustAddr, func(key string) error {
+		id, err := abi.ParseUIntKey(key)
+		if err != nil {
+			return err
+		}
+		actorId := abi.ActorID(id)
+		foundAddr, found := reverse[actorId]
+		acc.Require(found, "robust address map has %v for ID %v missing from address map", robustAddr, actorId)
+		acc.Require(!found || foundAddr == robustAddr, "robust address map has %v for ID %v, address map has %v", robustAddr, actorId, foundAddr)
+		robustCount++
+		return nil
+	})
+	acc.RequireNoError(err, "error iterating robust address map")
+	acc.Require(robustCount == len(reverse), "robust address map has %d entries, address map has %d", robustCount, len(reverse))
 	return initSummary, acc
 }
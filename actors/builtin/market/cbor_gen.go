@@ -13,7 +13,7 @@ import (
 
 var _ = xerrors.Errorf
 
-var lengthBufState = []byte{139}
+var lengthBufState = []byte{141}
 
 func (t *State) MarshalCBOR(w io.Writer) error {
 	if t == nil {
@@ -79,6 +79,18 @@ func (t *State) MarshalCBOR(w io.Writer) error {
 		}
 	}
 
+	// t.ProviderDeals (cid.Cid) (struct)
+
+	if err := cbg.WriteCidBuf(scratch, w, t.ProviderDeals); err != nil {
+		return xerrors.Errorf("failed to write cid field t.ProviderDeals: %w", err)
+	}
+
+	// t.ClientDeals (cid.Cid) (struct)
+
+	if err := cbg.WriteCidBuf(scratch, w, t.ClientDeals); err != nil {
+		return xerrors.Errorf("failed to write cid field t.ClientDeals: %w", err)
+	}
+
 	// t.TotalClientLockedCollateral (big.Int) (struct)
 	if err := t.TotalClientLockedCollateral.MarshalCBOR(w); err != nil {
 		return err
@@ -110,7 +122,7 @@ func (t *State) UnmarshalCBOR(r io.Reader) error {
 		return fmt.Errorf("cbor input should be of type array")
 	}
 
-	if extra != 11 {
+	if extra != 13 {
 		return fmt.Errorf("cbor input had wrong number of fields")
 	}
 
@@ -225,6 +237,30 @@ func (t *State) UnmarshalCBOR(r io.Reader) error {
 
 		t.LastCron = abi.ChainEpoch(extraI)
 	}
+	// t.ProviderDeals (cid.Cid) (struct)
+
+	{
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("failed to read cid field t.ProviderDeals: %w", err)
+		}
+
+		t.ProviderDeals = c
+
+	}
+	// t.ClientDeals (cid.Cid) (struct)
+
+	{
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("failed to read cid field t.ClientDeals: %w", err)
+		}
+
+		t.ClientDeals = c
+
+	}
 	// t.TotalClientLockedCollateral (big.Int) (struct)
 
 	{
@@ -195,7 +195,7 @@ func (a Actor) PublishStorageDeals(rt Runtime, params *PublishStorageDealsParams
 	rt.StateTransaction(&st, func() {
 		msm, err := st.mutator(adt.AsStore(rt)).withPendingProposals(WritePermission).
 			withDealProposals(WritePermission).withDealsByEpoch(WritePermission).withEscrowTable(WritePermission).
-			withLockedTable(WritePermission).build()
+			withLockedTable(WritePermission).withDealIndexes(WritePermission).build()
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load state")
 
 		// All storage dealProposals will be added in an atomic transaction; this operation will be unrolled if any of them fails.
@@ -235,6 +235,9 @@ func (a Actor) PublishStorageDeals(rt Runtime, params *PublishStorageDealsParams
 			err = msm.dealProposals.Set(id, &deal.Proposal)
 			builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to set deal")
 
+			err = msm.indexDeal(id, &deal.Proposal)
+			builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to index deal")
+
 			// We should randomize the first epoch for when the deal will be processed so an attacker isn't able to
 			// schedule too many deals for the same tick.
 			processEpoch, err := genRandNextEpoch(rt.CurrEpoch(), &deal.Proposal, rt.GetRandomnessFromBeacon)
@@ -312,7 +315,7 @@ func (a Actor) VerifyDealsForActivation(rt Runtime, params *VerifyDealsForActiva
 
 	var st State
 	rt.StateReadonly(&st)
-	store := adt.AsStore(rt)
+	store := adt.AsReadOnlyStore(rt)
 
 	proposals, err := AsDealProposalArray(store, st.Proposals)
 	builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load deal proposals")
@@ -410,7 +413,7 @@ func (a Actor) ComputeDataCommitment(rt Runtime, params *ComputeDataCommitmentPa
 
 	var st State
 	rt.StateReadonly(&st)
-	proposals, err := AsDealProposalArray(adt.AsStore(rt), st.Proposals)
+	proposals, err := AsDealProposalArray(adt.AsReadOnlyStore(rt), st.Proposals)
 	builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load deal dealProposals")
 
 	pieces := make([]abi.PieceInfo, 0)
@@ -504,7 +507,7 @@ func (a Actor) CronTick(rt Runtime, _ *abi.EmptyValue) *abi.EmptyValue {
 
 		msm, err := st.mutator(adt.AsStore(rt)).withDealStates(WritePermission).
 			withLockedTable(WritePermission).withEscrowTable(WritePermission).withDealsByEpoch(WritePermission).
-			withDealProposals(WritePermission).withPendingProposals(WritePermission).build()
+			withDealProposals(WritePermission).withPendingProposals(WritePermission).withDealIndexes(WritePermission).build()
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load state")
 
 		for i := st.LastCron + 1; i <= rt.CurrEpoch(); i++ {
@@ -536,6 +539,8 @@ func (a Actor) CronTick(rt Runtime, _ *abi.EmptyValue) *abi.EmptyValue {
 					if err := deleteDealProposalAndState(dealID, msm.dealStates, msm.dealProposals, true, false); err != nil {
 						builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to delete deal %d", dealID)
 					}
+					err = msm.unindexDeal(dealID, deal)
+					builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to unindex deal %d", dealID)
 
 					pdErr := msm.pendingDeals.Delete(abi.CidKey(dcid))
 					builtin.RequireNoErr(rt, pdErr, exitcode.ErrIllegalState, "failed to delete pending proposal %v", dcid)
@@ -557,6 +562,8 @@ func (a Actor) CronTick(rt Runtime, _ *abi.EmptyValue) *abi.EmptyValue {
 					amountSlashed = big.Add(amountSlashed, slashAmount)
 					err := deleteDealProposalAndState(dealID, msm.dealStates, msm.dealProposals, true, true)
 					builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to delete deal proposal and states")
+					err = msm.unindexDeal(dealID, deal)
+					builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to unindex deal %d", dealID)
 				} else {
 					builtin.RequireState(rt, nextEpoch > rt.CurrEpoch(), "continuing deal %d next epoch %d should be in future", dealID, nextEpoch)
 					builtin.RequireState(rt, slashAmount.IsZero(), "continuing deal %d should not be slashed", dealID)
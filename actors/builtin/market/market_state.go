@@ -2,11 +2,14 @@ package market
 
 import (
 	"bytes"
+	"sort"
 
+	addr "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/exitcode"
 	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
 	xerrors "golang.org/x/xerrors"
 
 	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
@@ -56,6 +59,11 @@ type State struct {
 	DealOpsByEpoch cid.Cid // SetMultimap, HAMT[epoch]Set
 	LastCron       abi.ChainEpoch
 
+	// Indexes of deals by provider and by client ID address, holding each deal's ID at the index of that ID.
+	// Deals are added to both when published and removed from both with their proposals.
+	ProviderDeals cid.Cid // Multimap, HAMT[addr.Address]AMT[DealID]DealID
+	ClientDeals   cid.Cid // Multimap, HAMT[addr.Address]AMT[DealID]DealID
+
 	// Total Client Collateral that is locked -> unlocked when deal is terminated
 	TotalClientLockedCollateral abi.TokenAmount
 	// Total Provider Collateral that is locked -> unlocked when deal is terminated
@@ -86,6 +94,10 @@ func ConstructState(store adt.Store) (*State, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("failed to create empty balance table: %w", err)
 	}
+	emptyDealIndexCid, err := adt.StoreEmptyMultimap(store, builtin.DefaultHamtBitwidth, ProposalsAmtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create empty deal index: %w", err)
+	}
 
 	return &State{
 		Proposals:        emptyProposalsArrayCid,
@@ -96,6 +108,8 @@ func ConstructState(store adt.Store) (*State, error) {
 		NextID:           abi.DealID(0),
 		DealOpsByEpoch:   emptyDealOpsHamtCid,
 		LastCron:         abi.ChainEpoch(-1),
+		ProviderDeals:    emptyDealIndexCid,
+		ClientDeals:      emptyDealIndexCid,
 
 		TotalClientLockedCollateral:   abi.NewTokenAmount(0),
 		TotalProviderLockedCollateral: abi.NewTokenAmount(0),
@@ -103,6 +117,77 @@ func ConstructState(store adt.Store) (*State, error) {
 	}, nil
 }
 
+// Returns the IDs of all deal proposals with the given provider, in ascending order.
+// Proposals record providers by ID address, so the argument must be an ID address.
+// Deals drop out of the result as soon as their proposals are deleted at expiry, termination or timeout.
+func (st *State) DealsForProvider(store adt.Store, provider addr.Address) ([]abi.DealID, error) {
+	if provider.Protocol() != addr.ID {
+		return nil, xerrors.Errorf("provider %v must be an ID address", provider)
+	}
+	providerDeals, err := adt.AsMultimap(store, st.ProviderDeals, builtin.DefaultHamtBitwidth, ProposalsAmtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load provider deals: %w", err)
+	}
+	return indexedDeals(providerDeals, provider)
+}
+
+// Returns the IDs of all deal proposals with the given client, in ascending order.
+// As with DealsForProvider, the argument must be an ID address.
+func (st *State) DealsForClient(store adt.Store, client addr.Address) ([]abi.DealID, error) {
+	if client.Protocol() != addr.ID {
+		return nil, xerrors.Errorf("client %v must be an ID address", client)
+	}
+	clientDeals, err := adt.AsMultimap(store, st.ClientDeals, builtin.DefaultHamtBitwidth, ProposalsAmtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load client deals: %w", err)
+	}
+	return indexedDeals(clientDeals, client)
+}
+
+// Returns the IDs of deals scheduled for processing by cron at any epoch after the last cron tick
+// up to and including the given epoch, in ascending order.
+// Deals are enqueued in DealOpsByEpoch when published and re-enqueued at their next update epoch
+// after each processing; this reports what the next CronTick at that epoch would visit.
+// Only epochs with deal ops scheduled are visited, so the cost is independent of the epoch given.
+func (st *State) DealsDueForProcessing(store adt.Store, epoch abi.ChainEpoch) ([]abi.DealID, error) {
+	dealOps, err := AsSetMultimap(store, st.DealOpsByEpoch, builtin.DefaultHamtBitwidth, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load deal ops: %w", err)
+	}
+	var dueEpochs []abi.ChainEpoch
+	if err := dealOps.ForEachKey(func(e abi.ChainEpoch) error {
+		if e > st.LastCron && e <= epoch {
+			dueEpochs = append(dueEpochs, e)
+		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to iterate deal op epochs: %w", err)
+	}
+	var ids []abi.DealID
+	for _, e := range dueEpochs {
+		if err := dealOps.ForEach(e, func(id abi.DealID) error {
+			ids = append(ids, id)
+			return nil
+		}); err != nil {
+			return nil, xerrors.Errorf("failed to iterate deal ops at epoch %d: %w", e, err)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Returns the deal IDs indexed under a party's address, in ascending order.
+func indexedDeals(index *adt.Multimap, party addr.Address) ([]abi.DealID, error) {
+	var ids []abi.DealID
+	if err := index.ForEach(abi.AddrKey(party), nil, func(i int64) error {
+		ids = append(ids, abi.DealID(i))
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to iterate deals for %v: %w", party, err)
+	}
+	return ids, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Deal state operations
 ////////////////////////////////////////////////////////////////////////////////
@@ -218,6 +303,33 @@ func (m *marketStateMutation) processDealExpired(rt Runtime, deal *DealProposal,
 	builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed unlocking deal client balance")
 }
 
+// Adds a deal to the indexes of deals by provider and by client.
+func (m *marketStateMutation) indexDeal(id abi.DealID, deal *DealProposal) error {
+	value := cbg.CborInt(id)
+	if err := m.providerDeals.Put(abi.AddrKey(deal.Provider), uint64(id), &value); err != nil {
+		return xerrors.Errorf("failed to index deal %d for provider %v: %w", id, deal.Provider, err)
+	}
+	if err := m.clientDeals.Put(abi.AddrKey(deal.Client), uint64(id), &value); err != nil {
+		return xerrors.Errorf("failed to index deal %d for client %v: %w", id, deal.Client, err)
+	}
+	return nil
+}
+
+// Removes a deal from the indexes of deals by provider and by client.
+func (m *marketStateMutation) unindexDeal(id abi.DealID, deal *DealProposal) error {
+	if removed, err := m.providerDeals.Remove(abi.AddrKey(deal.Provider), uint64(id)); err != nil {
+		return xerrors.Errorf("failed to unindex deal %d for provider %v: %w", id, deal.Provider, err)
+	} else if !removed {
+		return xerrors.Errorf("deal %d missing from index for provider %v", id, deal.Provider)
+	}
+	if removed, err := m.clientDeals.Remove(abi.AddrKey(deal.Client), uint64(id)); err != nil {
+		return xerrors.Errorf("failed to unindex deal %d for client %v: %w", id, deal.Client, err)
+	} else if !removed {
+		return xerrors.Errorf("deal %d missing from index for client %v", id, deal.Client)
+	}
+	return nil
+}
+
 func (m *marketStateMutation) generateStorageDealID() abi.DealID {
 	ret := m.nextDealId
 	m.nextDealId = m.nextDealId + abi.DealID(1)
@@ -292,6 +404,10 @@ type marketStateMutation struct {
 	dpePermit    MarketStateMutationPermission
 	dealsByEpoch *SetMultimap
 
+	indexPermit   MarketStateMutationPermission
+	providerDeals *adt.Multimap
+	clientDeals   *adt.Multimap
+
 	lockedPermit                  MarketStateMutationPermission
 	lockedTable                   *adt.BalanceTable
 	totalClientLockedCollateral   abi.TokenAmount
@@ -357,6 +473,20 @@ func (m *marketStateMutation) build() (*marketStateMutation, error) {
 		m.dealsByEpoch = dbe
 	}
 
+	if m.indexPermit != Invalid {
+		pd, err := adt.AsMultimap(m.store, m.st.ProviderDeals, builtin.DefaultHamtBitwidth, ProposalsAmtBitwidth)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to load provider deals: %w", err)
+		}
+		m.providerDeals = pd
+
+		cd, err := adt.AsMultimap(m.store, m.st.ClientDeals, builtin.DefaultHamtBitwidth, ProposalsAmtBitwidth)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to load client deals: %w", err)
+		}
+		m.clientDeals = cd
+	}
+
 	m.nextDealId = m.st.NextID
 
 	return m, nil
@@ -392,6 +522,11 @@ func (m *marketStateMutation) withDealsByEpoch(permit MarketStateMutationPermiss
 	return m
 }
 
+func (m *marketStateMutation) withDealIndexes(permit MarketStateMutationPermission) *marketStateMutation {
+	m.indexPermit = permit
+	return m
+}
+
 func (m *marketStateMutation) commitState() error {
 	var err error
 	if m.proposalPermit == WritePermission {
@@ -433,6 +568,15 @@ func (m *marketStateMutation) commitState() error {
 		}
 	}
 
+	if m.indexPermit == WritePermission {
+		if m.st.ProviderDeals, err = m.providerDeals.Root(); err != nil {
+			return xerrors.Errorf("failed to flush provider deals: %w", err)
+		}
+		if m.st.ClientDeals, err = m.clientDeals.Root(); err != nil {
+			return xerrors.Errorf("failed to flush client deals: %w", err)
+		}
+	}
+
 	m.st.NextID = m.nextDealId
 	return nil
 }
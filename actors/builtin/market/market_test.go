@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
 	"strings"
 	"testing"
 
@@ -2398,6 +2399,149 @@ func TestMarketActorDeals(t *testing.T) {
 	actor.checkState(rt)
 }
 
+func TestDealsForProvider(t *testing.T) {
+	owner := tutil.NewIDAddr(t, 101)
+	provider := tutil.NewIDAddr(t, 102)
+	worker := tutil.NewIDAddr(t, 103)
+	client := tutil.NewIDAddr(t, 104)
+	mAddr := &minerAddrs{owner, worker, provider, nil}
+	startEpoch := abi.ChainEpoch(50)
+	endEpoch := startEpoch + 200*builtin.EpochsInDay
+
+	rt, actor := basicMarketSetup(t, owner, provider, worker, client)
+	dealsForProvider := func(p address.Address) []abi.DealID {
+		var st market.State
+		rt.GetState(&st)
+		ids, err := st.DealsForProvider(adt.AsStore(rt), p)
+		require.NoError(t, err)
+		return ids
+	}
+	assert.Empty(t, dealsForProvider(provider))
+
+	deal1 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch, endEpoch, startEpoch)
+	deal2 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch+1, endEpoch, startEpoch+1)
+	deal3 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch+2, endEpoch, startEpoch+2)
+	assert.Equal(t, []abi.DealID{deal1, deal2, deal3}, dealsForProvider(provider))
+	assert.Empty(t, dealsForProvider(client))
+	assert.Empty(t, dealsForProvider(tutil.NewIDAddr(t, 999)))
+
+	// Providers must be queried by ID address.
+	var st market.State
+	rt.GetState(&st)
+	_, err := st.DealsForProvider(adt.AsStore(rt), tutil.NewBLSAddr(t, 1))
+	assert.Error(t, err)
+
+	// The first deal times out without activation and is deleted.
+	rt.SetEpoch(startEpoch)
+	rt.ExpectSend(builtin.BurntFundsActorAddr, builtin.MethodSend, nil, actor.getDealProposal(rt, deal1).ProviderCollateral, nil, exitcode.Ok)
+	actor.cronTick(rt)
+	assert.Equal(t, []abi.DealID{deal2, deal3}, dealsForProvider(provider))
+
+	// The second deal is activated then slashed, and deleted at its next cron processing.
+	actor.activateDeals(rt, endEpoch+1, provider, rt.Epoch(), deal2)
+	actor.terminateDeals(rt, provider, deal2)
+	rt.SetEpoch(startEpoch + 1)
+	rt.ExpectSend(builtin.BurntFundsActorAddr, builtin.MethodSend, nil, actor.getDealProposal(rt, deal2).ProviderCollateral, nil, exitcode.Ok)
+	actor.cronTick(rt)
+	assert.Equal(t, []abi.DealID{deal3}, dealsForProvider(provider))
+	actor.checkState(rt)
+}
+
+func TestDealsForClient(t *testing.T) {
+	owner := tutil.NewIDAddr(t, 101)
+	provider := tutil.NewIDAddr(t, 102)
+	worker := tutil.NewIDAddr(t, 103)
+	client := tutil.NewIDAddr(t, 104)
+	otherClient := tutil.NewIDAddr(t, 105)
+	mAddr := &minerAddrs{owner, worker, provider, nil}
+	startEpoch := abi.ChainEpoch(50)
+	endEpoch := startEpoch + 200*builtin.EpochsInDay
+
+	rt, actor := basicMarketSetup(t, owner, provider, worker, client)
+	dealsForClient := func(c address.Address) []abi.DealID {
+		var st market.State
+		rt.GetState(&st)
+		ids, err := st.DealsForClient(adt.AsStore(rt), c)
+		require.NoError(t, err)
+		return ids
+	}
+
+	deal1 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch, endEpoch, startEpoch)
+	deal2 := actor.generateAndPublishDeal(rt, otherClient, mAddr, startEpoch+1, endEpoch, startEpoch+1)
+	deal3 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch+2, endEpoch, startEpoch+2)
+	assert.Equal(t, []abi.DealID{deal1, deal3}, dealsForClient(client))
+	assert.Equal(t, []abi.DealID{deal2}, dealsForClient(otherClient))
+	assert.Empty(t, dealsForClient(provider))
+
+	// Clients must be queried by ID address.
+	var st market.State
+	rt.GetState(&st)
+	_, err := st.DealsForClient(adt.AsStore(rt), tutil.NewBLSAddr(t, 1))
+	assert.Error(t, err)
+
+	// Cleanup of a timed out deal removes it from both the client and provider views.
+	rt.SetEpoch(startEpoch)
+	rt.ExpectSend(builtin.BurntFundsActorAddr, builtin.MethodSend, nil, actor.getDealProposal(rt, deal1).ProviderCollateral, nil, exitcode.Ok)
+	actor.cronTick(rt)
+	assert.Equal(t, []abi.DealID{deal3}, dealsForClient(client))
+	assert.Equal(t, []abi.DealID{deal2}, dealsForClient(otherClient))
+
+	rt.GetState(&st)
+	providerDeals, err := st.DealsForProvider(adt.AsStore(rt), provider)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.DealID{deal2, deal3}, providerDeals)
+
+	// Expiry of the remaining deals once activated removes them from both indexes.
+	actor.activateDeals(rt, endEpoch+1, provider, rt.Epoch(), deal2, deal3)
+	rt.SetEpoch(endEpoch)
+	actor.cronTick(rt)
+	assert.Empty(t, dealsForClient(client))
+	assert.Empty(t, dealsForClient(otherClient))
+	rt.GetState(&st)
+	providerDeals, err = st.DealsForProvider(adt.AsStore(rt), provider)
+	require.NoError(t, err)
+	assert.Empty(t, providerDeals)
+	actor.checkState(rt)
+}
+
+func TestDealsDueForProcessing(t *testing.T) {
+	owner := tutil.NewIDAddr(t, 101)
+	provider := tutil.NewIDAddr(t, 102)
+	worker := tutil.NewIDAddr(t, 103)
+	client := tutil.NewIDAddr(t, 104)
+	mAddr := &minerAddrs{owner, worker, provider, nil}
+	startEpoch := abi.ChainEpoch(50)
+	endEpoch := startEpoch + 200*builtin.EpochsInDay
+
+	rt, actor := basicMarketSetup(t, owner, provider, worker, client)
+	dueBy := func(epoch abi.ChainEpoch) []abi.DealID {
+		var st market.State
+		rt.GetState(&st)
+		ids, err := st.DealsDueForProcessing(adt.AsStore(rt), epoch)
+		require.NoError(t, err)
+		return ids
+	}
+
+	deal1 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch, endEpoch, startEpoch)
+	deal2 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch+10, endEpoch, startEpoch+10)
+	deal3 := actor.generateAndPublishDeal(rt, client, mAddr, startEpoch+5, endEpoch, startEpoch+5)
+
+	assert.Empty(t, dueBy(startEpoch-1))
+	assert.Equal(t, []abi.DealID{deal1}, dueBy(startEpoch))
+	assert.Equal(t, []abi.DealID{deal1, deal3}, dueBy(startEpoch+9))
+	assert.Equal(t, []abi.DealID{deal1, deal2, deal3}, dueBy(startEpoch+10))
+	assert.Equal(t, []abi.DealID{deal1, deal2, deal3}, dueBy(abi.ChainEpoch(math.MaxInt64)))
+
+	// Processing the first deal, which times out, drains only its epoch.
+	rt.SetEpoch(startEpoch)
+	rt.ExpectSend(builtin.BurntFundsActorAddr, builtin.MethodSend, nil, actor.getDealProposal(rt, deal1).ProviderCollateral, nil, exitcode.Ok)
+	actor.cronTick(rt)
+	assert.Empty(t, dueBy(startEpoch))
+	assert.Equal(t, []abi.DealID{deal3}, dueBy(startEpoch+5))
+	assert.Equal(t, []abi.DealID{deal2, deal3}, dueBy(startEpoch+10))
+	actor.checkState(rt)
+}
+
 func TestMaxDealLabelSize(t *testing.T) {
 	owner := tutil.NewIDAddr(t, 101)
 	provider := tutil.NewIDAddr(t, 102)
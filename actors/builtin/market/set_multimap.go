@@ -144,6 +144,18 @@ func (mm *SetMultimap) ForEach(epoch abi.ChainEpoch, fn func(id abi.DealID) erro
 	return nil
 }
 
+// Iterates the keys which have values, in no particular order.
+// Iteration halts if the function returns an error.
+func (mm *SetMultimap) ForEachKey(fn func(epoch abi.ChainEpoch) error) error {
+	return mm.mp.ForEach(nil, func(k string) error {
+		epoch, err := abi.ParseUIntKey(k)
+		if err != nil {
+			return xerrors.Errorf("failed to parse key %v: %w", k, err)
+		}
+		return fn(abi.ChainEpoch(epoch))
+	})
+}
+
 func (mm *SetMultimap) get(key abi.Keyer) (*adt.Set, bool, error) {
 	var setRoot cbg.CborCid
 	found, err := mm.mp.Get(key, &setRoot)
@@ -18,6 +18,7 @@ import (
 
 type DealSummary struct {
 	Provider         address.Address
+	Client           address.Address
 	StartEpoch       abi.ChainEpoch
 	EndEpoch         abi.ChainEpoch
 	SectorStartEpoch abi.ChainEpoch
@@ -81,6 +82,7 @@ func CheckStateInvariants(st *State, store adt.Store, balance abi.TokenAmount, c
 			}
 			proposalStats[abi.DealID(dealID)] = &DealSummary{
 				Provider:         proposal.Provider,
+				Client:           proposal.Client,
 				StartEpoch:       proposal.StartEpoch,
 				EndEpoch:         proposal.EndEpoch,
 				SectorStartEpoch: abi.ChainEpoch(-1),
@@ -181,7 +183,7 @@ func CheckStateInvariants(st *State, store adt.Store, balance abi.TokenAmount, c
 		var lockedAmount abi.TokenAmount
 		lockedTotal := abi.NewTokenAmount(0)
 		err = (*adt.Map)(lockTable).ForEach(&lockedAmount, func(key string) error {
-			addr, err := address.NewFromBytes([]byte(key))
+			addr, err := adt.ParseAddrKey(key)
 			if err != nil {
 				return err
 			}
@@ -245,6 +247,13 @@ func CheckStateInvariants(st *State, store adt.Store, balance abi.TokenAmount, c
 
 	acc.Require(len(expectedDealOps) == 0, "missing deal ops for proposals: %v", expectedDealOps)
 
+	//
+	// Deals by party
+	//
+
+	checkDealIndex(acc, store, st.ProviderDeals, "provider", proposalStats, func(d *DealSummary) address.Address { return d.Provider })
+	checkDealIndex(acc, store, st.ClientDeals, "client", proposalStats, func(d *DealSummary) address.Address { return d.Client })
+
 	return &StateSummary{
 		Deals:                proposalStats,
 		PendingProposalCount: pendingProposalCount,
@@ -254,3 +263,37 @@ func CheckStateInvariants(st *State, store adt.Store, balance abi.TokenAmount, c
 		DealOpCount:          dealOpCount,
 	}, acc
 }
+
+// Checks that an index of deals by party holds exactly the proposed deals, each under its party's address.
+func checkDealIndex(acc *builtin.MessageAccumulator, store adt.Store, root cid.Cid, name string,
+	proposalStats map[abi.DealID]*DealSummary, partyOf func(*DealSummary) address.Address) {
+	index, err := adt.AsMultimap(store, root, builtin.DefaultHamtBitwidth, ProposalsAmtBitwidth)
+	if err != nil {
+		acc.Addf("error loading %s deals: %v", name, err)
+		return
+	}
+
+	indexed := make(map[abi.DealID]struct{})
+	var value cbg.CborInt
+	err = index.ForAllValues(&value, func(key string, i int64) error {
+		party, err := adt.ParseAddrKey(key)
+		if err != nil {
+			return err
+		}
+		id := abi.DealID(i)
+		acc.Require(int64(value) == i, "%s %v deal index %d holds deal %d", name, party, i, value)
+
+		_, duplicate := indexed[id]
+		acc.Require(!duplicate, "deal %d indexed under more than one %s", id, name)
+		indexed[id] = struct{}{}
+
+		if stats, found := proposalStats[id]; !found {
+			acc.Addf("%s %v indexes deal %d with missing proposal", name, party, id)
+		} else {
+			acc.Require(partyOf(stats) == party, "%s %v indexes deal %d with %s %v", name, party, id, name, partyOf(stats))
+		}
+		return nil
+	})
+	acc.RequireNoError(err, "error iterating %s deals", name)
+	acc.Require(len(indexed) == len(proposalStats), "%s deals index %d deals, proposals hold %d", name, len(indexed), len(proposalStats))
+}
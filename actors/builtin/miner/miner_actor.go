@@ -144,7 +144,8 @@ func (a Actor) ControlAddresses(rt Runtime, _ *abi.EmptyValue) *GetControlAddres
 	rt.ValidateImmediateCallerAcceptAny()
 	var st State
 	rt.StateReadonly(&st)
-	info := getMinerInfo(rt, &st)
+	info, err := st.GetInfo(adt.AsReadOnlyStore(rt))
+	builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "could not read miner info")
 	return &GetControlAddressesReturn{
 		Owner:        info.Owner,
 		Worker:       info.Worker,
@@ -408,6 +408,30 @@ func (st *State) FindPrecommittedSectors(store adt.Store, sectorNos ...abi.Secto
 	return result, nil
 }
 
+// Returns the deposit locked for each pre-committed sector.
+// Deposits are recorded on each pre-commitment, with their sum held in PreCommitDeposits; they are locked
+// by PreCommitSector, released when the sector is proven, and burnt when the pre-commitment expires.
+func (st *State) PreCommitDepositsBySector(store adt.Store) (map[abi.SectorNumber]abi.TokenAmount, error) {
+	precommitted, err := adt.AsMap(store, st.PreCommittedSectors, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, err
+	}
+
+	deposits := map[abi.SectorNumber]abi.TokenAmount{}
+	var info SectorPreCommitOnChainInfo
+	if err := precommitted.ForEach(&info, func(key string) error {
+		sectorNo, err := abi.ParseUIntKey(key)
+		if err != nil {
+			return xerrors.Errorf("invalid pre-commitment key %x: %w", key, err)
+		}
+		deposits[abi.SectorNumber(sectorNo)] = info.PreCommitDeposit
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to iterate pre-commitments: %w", err)
+	}
+	return deposits, nil
+}
+
 func (st *State) DeletePrecommittedSectors(store adt.Store, sectorNos ...abi.SectorNumber) error {
 	precommitted, err := adt.AsMap(store, st.PreCommittedSectors, builtin.DefaultHamtBitwidth)
 	if err != nil {
@@ -505,6 +529,43 @@ func (st *State) FindSector(store adt.Store, sno abi.SectorNumber) (uint64, uint
 	return FindSector(store, deadlines, sno)
 }
 
+// Returns the numbers of all sectors, on-time or early, that are scheduled in some partition's
+// expiration queue to expire at or before the given epoch.
+// Expirations are quantized to each deadline's schedule, so this is the set of sectors that cron
+// would expire by processing deadlines up to that epoch. State is not modified.
+func (st *State) SectorsExpiringBy(store adt.Store, until abi.ChainEpoch) (bitfield.BitField, error) {
+	deadlines, err := st.LoadDeadlines(store)
+	if err != nil {
+		return bitfield.BitField{}, err
+	}
+
+	var expiring []bitfield.BitField
+	if err := deadlines.ForEach(store, func(dlIdx uint64, dl *Deadline) error {
+		partitions, err := dl.PartitionsArray(store)
+		if err != nil {
+			return err
+		}
+		quant := st.QuantSpecForDeadline(dlIdx)
+		var partition Partition
+		return partitions.ForEach(&partition, func(partIdx int64) error {
+			queue, err := LoadExpirationQueue(store, partition.ExpirationsEpochs, quant, PartitionExpirationAmtBitwidth)
+			if err != nil {
+				return xerrors.Errorf("failed to load expiration queue for deadline %d partition %d: %w", dlIdx, partIdx, err)
+			}
+			return queue.traverse(func(epoch abi.ChainEpoch, es *ExpirationSet) (bool, error) {
+				if epoch > until {
+					return false, nil
+				}
+				expiring = append(expiring, es.OnTimeSectors, es.EarlySectors)
+				return true, nil
+			})
+		})
+	}); err != nil {
+		return bitfield.BitField{}, xerrors.Errorf("failed to traverse expiration queues: %w", err)
+	}
+	return bitfield.MultiMerge(expiring...)
+}
+
 // Schedules each sector to expire at its next deadline end. If it can't find
 // any given sector, it skips it.
 //
@@ -67,6 +67,46 @@ func TestPrecommittedSectorsStore(t *testing.T) {
 	})
 }
 
+func TestPreCommitDeposits(t *testing.T) {
+	harness := constructStateHarness(t, abi.ChainEpoch(0))
+	depositsBySector := func() map[abi.SectorNumber]int64 {
+		deposits, err := harness.s.PreCommitDepositsBySector(harness.store)
+		require.NoError(t, err)
+		total := big.Zero()
+		values := map[abi.SectorNumber]int64{}
+		for sectorNo, d := range deposits {
+			total = big.Add(total, d)
+			values[sectorNo] = d.Int64()
+		}
+		assert.True(t, harness.s.PreCommitDeposits.Equals(total))
+		return values
+	}
+	assert.Empty(t, depositsBySector())
+
+	// Lock.
+	expiration := abi.ChainEpoch(100)
+	for _, sectorNo := range []abi.SectorNumber{1, 2, 3} {
+		deposit := abi.NewTokenAmount(int64(sectorNo) * 10)
+		pc := newPreCommitOnChain(sectorNo, tutils.MakeCID(fmt.Sprintf("%d", sectorNo), &miner.SealedCIDPrefix), deposit, 1)
+		require.NoError(t, harness.s.PutPrecommittedSectors(harness.store, pc))
+		require.NoError(t, harness.s.AddPreCommitDeposit(deposit))
+	}
+	require.NoError(t, harness.s.AddPreCommitExpirations(harness.store, map[abi.ChainEpoch][]uint64{expiration: {1, 2, 3}}))
+	assert.Equal(t, map[abi.SectorNumber]int64{1: 10, 2: 20, 3: 30}, depositsBySector())
+
+	// Release, as when a sector is proven.
+	harness.deletePreCommit(2)
+	require.NoError(t, harness.s.AddPreCommitDeposit(abi.NewTokenAmount(-20)))
+	assert.Equal(t, map[abi.SectorNumber]int64{1: 10, 3: 30}, depositsBySector())
+
+	// Burn the remainder on expiry.
+	burnt, err := harness.s.ExpirePreCommits(harness.store, expiration+miner.WPoStProvingPeriod)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), burnt.Int64())
+	assert.Empty(t, depositsBySector())
+	assert.True(t, harness.s.PreCommitDeposits.IsZero())
+}
+
 func TestSectorsStore(t *testing.T) {
 	t.Run("Put get and delete", func(t *testing.T) {
 		harness := constructStateHarness(t, abi.ChainEpoch(0))
@@ -745,6 +785,39 @@ func TestSectorAssignment(t *testing.T) {
 	})
 }
 
+func TestSectorsExpiringBy(t *testing.T) {
+	partitionSectors, err := builtin.SealProofWindowPoStPartitionSectors(abi.RegisteredSealProof_StackedDrg32GiBV1_1)
+	require.NoError(t, err)
+	sectorSize, err := abi.RegisteredSealProof_StackedDrg32GiBV1_1.SectorSize()
+	require.NoError(t, err)
+
+	harness := constructStateHarness(t, abi.ChainEpoch(0))
+	firstExpiration := 10 * miner.WPoStProvingPeriod
+	// Sectors expire one, three and six proving periods apart, across more than one partition.
+	var sectorInfos []*miner.SectorOnChainInfo
+	for i, periods := range []abi.ChainEpoch{0, 3, 6} {
+		for j := uint64(0); j < partitionSectors; j++ {
+			sectorNo := abi.SectorNumber(uint64(i)*partitionSectors + j)
+			info := newSectorOnChainInfo(sectorNo, tutils.MakeCID(fmt.Sprintf("%d", sectorNo), &miner.SealedCIDPrefix), big.NewInt(1), 0)
+			info.Expiration = firstExpiration + periods*miner.WPoStProvingPeriod
+			sectorInfos = append(sectorInfos, info)
+		}
+	}
+	require.NoError(t, harness.s.AssignSectorsToDeadlines(harness.store, 0, sectorInfos, partitionSectors, sectorSize))
+	stateBefore := *harness.s
+
+	expiringBy := func(epoch abi.ChainEpoch) bitfield.BitField {
+		expiring, err := harness.s.SectorsExpiringBy(harness.store, epoch)
+		require.NoError(t, err)
+		return expiring
+	}
+	assertBitfieldEmpty(t, expiringBy(firstExpiration-miner.WPoStProvingPeriod))
+	assertBitfieldsEqual(t, seq(t, 0, partitionSectors), expiringBy(firstExpiration+miner.WPoStProvingPeriod))
+	assertBitfieldsEqual(t, seq(t, 0, 2*partitionSectors), expiringBy(firstExpiration+4*miner.WPoStProvingPeriod))
+	assertBitfieldsEqual(t, seq(t, 0, 3*partitionSectors), expiringBy(firstExpiration+7*miner.WPoStProvingPeriod))
+	assert.Equal(t, stateBefore, *harness.s)
+}
+
 func TestSectorNumberAllocation(t *testing.T) {
 	allocate := func(h *stateHarness, numbers ...uint64) error {
 		return h.s.AllocateSectorNumbers(h.store, bitfield.NewFromSet(numbers), miner.DenyCollisions)
@@ -173,7 +173,7 @@ func (a Actor) Propose(rt runtime.Runtime, params *ProposeParams) *ProposeReturn
 			rt.Abortf(exitcode.ErrForbidden, "%s is not a signer", proposer)
 		}
 
-		ptx, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
+		ptx, err := AsTransactionMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load pending transactions")
 
 		txnID = st.NextTxnID
@@ -186,7 +186,7 @@ func (a Actor) Propose(rt runtime.Runtime, params *ProposeParams) *ProposeReturn
 			Approved: []addr.Address{},
 		}
 
-		if err := ptx.Put(txnID, txn); err != nil {
+		if err := ptx.Put(txnID, *txn); err != nil {
 			rt.Abortf(exitcode.ErrIllegalState, "failed to put transaction for propose: %v", err)
 		}
 
@@ -235,7 +235,7 @@ func (a Actor) Approve(rt runtime.Runtime, params *TxnIDParams) *ApproveReturn {
 			rt.Abortf(exitcode.ErrForbidden, "%s is not a signer", approver)
 		}
 
-		ptx, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
+		ptx, err := AsTransactionMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load pending transactions")
 
 		txn = getTransaction(rt, ptx, params.ID, params.ProposalHash, true)
@@ -267,11 +267,10 @@ func (a Actor) Cancel(rt runtime.Runtime, params *TxnIDParams) *abi.EmptyValue {
 			rt.Abortf(exitcode.ErrForbidden, "%s is not a signer", callerAddr)
 		}
 
-		ptx, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
+		ptx, err := AsTransactionMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load pending txns")
 
-		var txn Transaction
-		found, err := ptx.Pop(params.ID, &txn)
+		txn, found, err := ptx.Pop(params.ID)
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to pop transaction %v for cancel", params.ID)
 		if !found {
 			rt.Abortf(exitcode.ErrNotFound, "no such transaction %v to cancel", params.ID)
@@ -485,12 +484,12 @@ func (a Actor) approveTransaction(rt runtime.Runtime, txnID TxnID, txn *Transact
 
 	// add the caller to the list of approvers
 	rt.StateTransaction(&st, func() {
-		ptx, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
+		ptx, err := AsTransactionMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load pending transactions")
 
 		// update approved on the transaction
 		txn.Approved = append(txn.Approved, caller)
-		err = ptx.Put(txnID, txn)
+		err = ptx.Put(txnID, *txn)
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to put transaction %v for approval", txnID)
 
 		st.PendingTxns, err = ptx.Root()
@@ -500,10 +499,9 @@ func (a Actor) approveTransaction(rt runtime.Runtime, txnID TxnID, txn *Transact
 	return executeTransactionIfApproved(rt, st, txnID, txn)
 }
 
-func getTransaction(rt runtime.Runtime, ptx *adt.Map, txnID TxnID, proposalHash []byte, checkHash bool) *Transaction {
+func getTransaction(rt runtime.Runtime, ptx *TransactionMap, txnID TxnID, proposalHash []byte, checkHash bool) *Transaction {
 	// get transaction from the state trie
-	var txn Transaction
-	found, err := ptx.Get(txnID, &txn)
+	txn, found, err := ptx.Get(txnID)
 	builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load transaction %v for approval", txnID)
 	if !found {
 		rt.Abortf(exitcode.ErrNotFound, "no such transaction %v for approval", txnID)
@@ -544,7 +542,7 @@ func executeTransactionIfApproved(rt runtime.Runtime, st State, txnID TxnID, txn
 
 		// This could be rearranged to happen inside the first state transaction, before the send().
 		rt.StateTransaction(&st, func() {
-			ptx, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
+			ptx, err := AsTransactionMap(adt.AsStore(rt), st.PendingTxns, builtin.DefaultHamtBitwidth)
 			builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load pending transactions")
 
 			// Allow transaction not to be found when deleting.
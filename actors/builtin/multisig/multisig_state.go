@@ -1,6 +1,8 @@
 package multisig
 
 import (
+	"sort"
+
 	address "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
@@ -11,6 +13,8 @@ import (
 	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
 )
 
+//go:generate go run github.com/filecoin-project/specs-actors/v5/gen/typedmap -type=Transaction
+
 type State struct {
 	Signers               []address.Address // Signers must be canonical ID-addresses.
 	NumApprovalsThreshold uint64
@@ -67,16 +71,15 @@ func (st *State) AmountLocked(elapsedEpoch abi.ChainEpoch) abi.TokenAmount {
 // Iterates all pending transactions and removes an address from each list of approvals, if present.
 // If an approval list becomes empty, the pending transaction is deleted.
 func (st *State) PurgeApprovals(store adt.Store, addr address.Address) error {
-	txns, err := adt.AsMap(store, st.PendingTxns, builtin.DefaultHamtBitwidth)
+	txns, err := AsTransactionMap(store, st.PendingTxns, builtin.DefaultHamtBitwidth)
 	if err != nil {
 		return xerrors.Errorf("failed to load transactions: %w", err)
 	}
 
 	// Identify the transactions that need updating.
-	var txnIdsToPurge []string              // For stable iteration
-	txnsToPurge := map[string]Transaction{} // Values are not pointers, we need copies
-	var txn Transaction
-	if err = txns.ForEach(&txn, func(txid string) error {
+	var txnIdsToPurge []string // For stable iteration
+	txnsToPurge := map[string]Transaction{}
+	if err = txns.ForEach(func(txid string, txn Transaction) error {
 		for _, approver := range txn.Approved {
 			if approver == addr {
 				txnIdsToPurge = append(txnIdsToPurge, txid)
@@ -102,7 +105,7 @@ func (st *State) PurgeApprovals(store adt.Store, addr address.Address) error {
 
 		if len(newApprovers) > 0 {
 			txn.Approved = newApprovers
-			if err := txns.Put(StringKey(txid), &txn); err != nil {
+			if err := txns.Put(StringKey(txid), txn); err != nil {
 				return xerrors.Errorf("failed to update transaction approvers: %w", err)
 			}
 		} else {
@@ -120,6 +123,35 @@ func (st *State) PurgeApprovals(store adt.Store, addr address.Address) error {
 	return nil
 }
 
+// A pending transaction together with its ID.
+type PendingTxn struct {
+	ID TxnID
+	Transaction
+}
+
+// Returns all pending transactions in ascending order of transaction ID.
+func (st *State) ListPendingTxns(store adt.Store) ([]PendingTxn, error) {
+	txns, err := AsTransactionMap(store, st.PendingTxns, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load transactions: %w", err)
+	}
+
+	var pending []PendingTxn
+	if err = txns.ForEach(func(key string, txn Transaction) error {
+		id, err := ParseTxnIDKey(key)
+		if err != nil {
+			return xerrors.Errorf("invalid transaction key %x: %w", key, err)
+		}
+		pending = append(pending, PendingTxn{ID: id, Transaction: txn})
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to traverse transactions: %w", err)
+	}
+	// Keys are varint-encoded, so neither hash nor key order is numeric order.
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	return pending, nil
+}
+
 // return nil if MultiSig maintains required locked balance after spending the amount, else return an error.
 func (st *State) assertAvailable(currBalance abi.TokenAmount, amountToSpend abi.TokenAmount, currEpoch abi.ChainEpoch) error {
 	if amountToSpend.LessThan(big.Zero()) {
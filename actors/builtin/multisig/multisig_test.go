@@ -518,6 +518,56 @@ func TestPropose(t *testing.T) {
 	})
 }
 
+func TestListPendingTxns(t *testing.T) {
+	actor := msActorHarness{multisig.Actor{}, t}
+	receiver := tutil.NewIDAddr(t, 100)
+	anne := tutil.NewIDAddr(t, 101)
+	bob := tutil.NewIDAddr(t, 102)
+	chuck := tutil.NewIDAddr(t, 103)
+
+	rt := mock.NewBuilder(receiver).
+		WithCaller(builtin.InitActorAddr, builtin.InitActorCodeID).
+		WithHasher(blake2b.Sum256).
+		Build(t)
+	actor.constructAndVerify(rt, 2, 0, 0, anne, bob)
+
+	listPending := func() []multisig.PendingTxn {
+		var st multisig.State
+		rt.GetState(&st)
+		pending, err := st.ListPendingTxns(adt.AsStore(rt))
+		require.NoError(t, err)
+		return pending
+	}
+	assert.Empty(t, listPending())
+
+	// Enough proposals that some IDs have multi-byte keys.
+	const count = 70
+	var hashes [][]byte
+	rt.SetCaller(anne, builtin.AccountActorCodeID)
+	for i := 0; i < count; i++ {
+		hashes = append(hashes, actor.proposeOK(rt, chuck, abi.NewTokenAmount(int64(i)), builtin.MethodSend, nil, nil))
+	}
+
+	pending := listPending()
+	require.Len(t, pending, count)
+	for i, p := range pending {
+		assert.Equal(t, multisig.TxnID(i), p.ID)
+		assert.Equal(t, multisig.Transaction{
+			To:       chuck,
+			Value:    abi.NewTokenAmount(int64(i)),
+			Method:   builtin.MethodSend,
+			Approved: []addr.Address{anne},
+		}, p.Transaction)
+	}
+
+	actor.cancel(rt, 1, hashes[1])
+	pending = listPending()
+	require.Len(t, pending, count-1)
+	assert.Equal(t, multisig.TxnID(0), pending[0].ID)
+	assert.Equal(t, multisig.TxnID(2), pending[1].ID)
+	actor.checkState(rt)
+}
+
 func TestApprove(t *testing.T) {
 	actor := msActorHarness{multisig.Actor{}, t}
 	startEpoch := abi.ChainEpoch(0)
@@ -37,11 +37,10 @@ func CheckStateInvariants(st *State, store adt.Store) (*StateSummary, *builtin.M
 	// test pending transactions
 	maxTxnID := TxnID(-1)
 	numPending := uint64(0)
-	if transactions, err := adt.AsMap(store, st.PendingTxns, builtin.DefaultHamtBitwidth); err != nil {
+	if transactions, err := AsTransactionMap(store, st.PendingTxns, builtin.DefaultHamtBitwidth); err != nil {
 		acc.Addf("error loading transactions: %v", err)
 	} else {
-		var txn Transaction
-		err = transactions.ForEach(&txn, func(txnIDStr string) error {
+		err = transactions.ForEach(func(txnIDStr string, txn Transaction) error {
 			txnID, err := ParseTxnIDKey(txnIDStr)
 			if err != nil {
 				return err
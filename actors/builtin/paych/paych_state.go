@@ -5,6 +5,9 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
 )
 
 // A given payment channel actor is established by From
@@ -47,3 +50,25 @@ func ConstructState(from addr.Address, to addr.Address, emptyArrCid cid.Cid) *St
 		LaneStates:      emptyArrCid,
 	}
 }
+
+// Finalizes a settled channel's lanes, removing every lane state in one batch, and returns the total
+// amount to be paid out to `To`.
+// The total is ToSend rather than a sum over lanes, whose redeemed amounts overlap where lanes were merged.
+// Removing a lane also forgets its nonce, so this is permitted only once the channel is settled and
+// no further vouchers can be processed.
+func (st *State) SettleAllLanes(store adt.Store, currEpoch abi.ChainEpoch) (abi.TokenAmount, error) {
+	if st.SettlingAt == 0 || currEpoch < st.SettlingAt {
+		return big.Zero(), xerrors.Errorf("channel not settled at epoch %d, settling at %d", currEpoch, st.SettlingAt)
+	}
+	lanes, err := adt.AsArray(store, st.LaneStates, LaneStatesAmtBitwidth)
+	if err != nil {
+		return big.Zero(), xerrors.Errorf("failed to load lanes: %w", err)
+	}
+	if _, err := lanes.DeleteRange(0, MaxLane+1); err != nil {
+		return big.Zero(), xerrors.Errorf("failed to delete lanes: %w", err)
+	}
+	if st.LaneStates, err = lanes.Root(); err != nil {
+		return big.Zero(), xerrors.Errorf("failed to save lanes: %w", err)
+	}
+	return st.ToSend, nil
+}
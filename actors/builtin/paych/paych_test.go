@@ -419,6 +419,58 @@ func TestActor_UpdateChannelStateRedeem(t *testing.T) {
 	})
 }
 
+func TestActor_UpdateChannelStateNonces(t *testing.T) {
+	rt, actor, sv := requireCreateChannelWithLanes(t, 1)
+	var st State
+	rt.GetState(&st)
+
+	// Each redemption of a lane records the voucher's nonce and amount, and later vouchers
+	// for the lane must carry a strictly greater nonce.
+	redeem := func(nonce uint64, amount int64, expectExit exitcode.ExitCode) {
+		ucp := &UpdateChannelStateParams{Sv: *sv}
+		ucp.Sv.Nonce = nonce
+		ucp.Sv.Amount = big.NewInt(amount)
+
+		rt.SetCaller(actor.payee, builtin.AccountActorCodeID)
+		rt.ExpectValidateCallerAddr(st.From, st.To)
+		rt.ExpectVerifySignature(*ucp.Sv.Signature, actor.payer, voucherBytes(t, &ucp.Sv), nil)
+		if expectExit == exitcode.Ok {
+			rt.Call(actor.UpdateChannelState, ucp)
+		} else {
+			rt.ExpectAbortContainsMessage(expectExit, "outdated nonce", func() {
+				rt.Call(actor.UpdateChannelState, ucp)
+			})
+		}
+		rt.Verify()
+	}
+	assertLane := func(nonce uint64, redeemed int64) {
+		rt.GetState(&st)
+		ls := getLaneState(t, rt, st.LaneStates, sv.Lane)
+		assert.Equal(t, nonce, ls.Nonce)
+		assert.Equal(t, big.NewInt(redeemed), ls.Redeemed)
+		assert.Equal(t, big.NewInt(redeemed), st.ToSend)
+	}
+	assertLane(1, 1)
+
+	// In order.
+	redeem(2, 5, exitcode.Ok)
+	assertLane(2, 5)
+	redeem(3, 7, exitcode.Ok)
+	assertLane(3, 7)
+
+	// Replays of the current or an earlier nonce.
+	redeem(3, 8, exitcode.ErrIllegalArgument)
+	redeem(2, 8, exitcode.ErrIllegalArgument)
+	assertLane(3, 7)
+
+	// Gaps are permitted, but skipped nonces cannot be redeemed afterwards.
+	redeem(10, 9, exitcode.Ok)
+	assertLane(10, 9)
+	redeem(9, 10, exitcode.ErrIllegalArgument)
+	assertLane(10, 9)
+	actor.checkState(rt)
+}
+
 func TestActor_UpdateChannelStateMergeSuccess(t *testing.T) {
 	// Check that a lane merge correctly updates lane states
 	numLanes := 3
@@ -793,6 +845,41 @@ func TestActor_Settle(t *testing.T) {
 	})
 }
 
+func TestState_SettleAllLanes(t *testing.T) {
+	// Lanes 0, 1 and 2 redeem 1, 2 and 3 respectively.
+	rt, actor, sv := requireCreateChannelWithLanes(t, 3)
+	var st State
+	rt.GetState(&st)
+
+	// Merge lane 1 into lane 2, so the lanes' redeemed amounts overlap.
+	ucp := &UpdateChannelStateParams{Sv: *sv}
+	ucp.Sv.Amount = big.NewInt(10)
+	ucp.Sv.Merges = []Merge{{Lane: 1, Nonce: 10}}
+	rt.SetCaller(actor.payee, builtin.AccountActorCodeID)
+	rt.ExpectValidateCallerAddr(st.From, st.To)
+	rt.ExpectVerifySignature(*ucp.Sv.Signature, actor.payer, voucherBytes(t, &ucp.Sv), nil)
+	rt.Call(actor.UpdateChannelState, ucp)
+	rt.Verify()
+
+	rt.SetCaller(st.From, builtin.AccountActorCodeID)
+	rt.ExpectValidateCallerAddr(st.From, st.To)
+	rt.Call(actor.Settle, nil)
+	rt.GetState(&st)
+	actor.checkState(rt)
+
+	_, err := st.SettleAllLanes(adt.AsStore(rt), st.SettlingAt-1)
+	require.Error(t, err)
+
+	total, err := st.SettleAllLanes(adt.AsStore(rt), st.SettlingAt)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(11), total)
+	assert.Equal(t, big.NewInt(11), st.ToSend)
+
+	lanes, err := adt.AsArray(adt.AsStore(rt), st.LaneStates, LaneStatesAmtBitwidth)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), lanes.Length())
+}
+
 func TestActor_Collect(t *testing.T) {
 	t.Run("Happy path", func(t *testing.T) {
 		rt, actor, _ := requireCreateChannelWithLanes(t, 1)
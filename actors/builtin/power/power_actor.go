@@ -354,7 +354,7 @@ func (a Actor) processBatchProofVerifies(rt Runtime) {
 		builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to load claims")
 
 		err = mmap.ForAll(func(k string, arr *adt.Array) error {
-			a, err := addr.NewFromBytes([]byte(k))
+			a, err := adt.ParseAddrKey(k)
 			builtin.RequireNoErr(rt, err, exitcode.ErrIllegalState, "failed to parse address key")
 
 			// refuse to process proofs for miner with no claim
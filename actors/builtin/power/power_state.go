@@ -177,6 +177,25 @@ func (st *State) GetClaim(s adt.Store, a addr.Address) (*Claim, bool, error) {
 	return getClaim(claims, a)
 }
 
+// Iterates all claims in ascending order of the canonical byte encoding of the miner address,
+// which is independent of the HAMT's hash order. Note this is not numeric order for ID addresses.
+// The claim provided to the callback is not safe for re-use.
+// Iteration halts if the function returns an error, which is returned unless it is adt.StopIteration.
+func (st *State) ForEachClaimSorted(s adt.Store, fn func(miner addr.Address, claim *Claim) error) error {
+	claims, err := adt.AsMap(s, st.Claims, builtin.DefaultHamtBitwidth)
+	if err != nil {
+		return xerrors.Errorf("failed to load claims: %w", err)
+	}
+	var claim Claim
+	return claims.ForEachSorted(&claim, func(key string) error {
+		miner, err := addr.NewFromBytes([]byte(key))
+		if err != nil {
+			return xerrors.Errorf("invalid claim key %x: %w", key, err)
+		}
+		return fn(miner, &claim)
+	})
+}
+
 func (st *State) addToClaim(claims *adt.Map, miner addr.Address, power abi.StoragePower, qapower abi.StoragePower) error {
 	oldClaim, ok, err := getClaim(claims, miner)
 	if err != nil {
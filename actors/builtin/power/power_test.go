@@ -522,6 +522,47 @@ func TestPowerAndPledgeAccounting(t *testing.T) {
 	})
 }
 
+func TestForEachClaimSorted(t *testing.T) {
+	actor := newHarness(t)
+	owner := tutil.NewIDAddr(t, 101)
+	rt := mock.NewBuilder(builtin.StoragePowerActorAddr).
+		WithCaller(builtin.SystemActorAddr, builtin.SystemActorCodeID).
+		Build(t)
+	actor.constructAndVerify(rt)
+
+	// Claims are ordered by address bytes, in which the ID is varint-encoded.
+	for _, id := range []uint64{1000, 5, 2000, 129} {
+		miner := tutil.NewIDAddr(t, id)
+		actor.createMinerBasic(rt, owner, owner, miner)
+		actor.updateClaimedPower(rt, miner, abi.NewStoragePower(int64(id)), abi.NewStoragePower(int64(id)))
+	}
+
+	var st power.State
+	rt.GetState(&st)
+	var visited []uint64
+	require.NoError(t, st.ForEachClaimSorted(adt.AsStore(rt), func(miner addr.Address, claim *power.Claim) error {
+		id, err := addr.IDFromAddress(miner)
+		require.NoError(t, err)
+		assert.Equal(t, abi.NewStoragePower(int64(id)), claim.RawBytePower)
+		visited = append(visited, id)
+		return nil
+	}))
+	assert.Equal(t, []uint64{5, 129, 2000, 1000}, visited)
+
+	visited = nil
+	require.NoError(t, st.ForEachClaimSorted(adt.AsStore(rt), func(miner addr.Address, _ *power.Claim) error {
+		id, err := addr.IDFromAddress(miner)
+		require.NoError(t, err)
+		visited = append(visited, id)
+		if len(visited) == 2 {
+			return adt.StopIteration
+		}
+		return nil
+	}))
+	assert.Equal(t, []uint64{5, 129}, visited)
+	actor.checkState(rt)
+}
+
 func TestUpdatePledgeTotal(t *testing.T) {
 	// most coverage of update pledge total is in accounting test above
 
@@ -104,7 +104,7 @@ func CheckClaimInvariants(st *State, store adt.Store, acc *builtin.MessageAccumu
 	claimsWithSufficientPowerCount := int64(0)
 	var claim Claim
 	err = claims.ForEach(&claim, func(key string) error {
-		addr, err := address.NewFromBytes([]byte(key))
+		addr, err := adt.ParseAddrKey(key)
 		if err != nil {
 			return err
 		}
@@ -156,7 +156,7 @@ func CheckProofValidationInvariants(st *State, store adt.Store, claims ClaimsByA
 		acc.Addf("error loading proof validation queue: %v", err)
 	} else {
 		err = queue.ForAll(func(key string, arr *adt.Array) error {
-			addr, err := address.NewFromBytes([]byte(key))
+			addr, err := adt.ParseAddrKey(key)
 			if err != nil {
 				return err
 			}
@@ -26,7 +26,7 @@ func CheckStateInvariants(st *State, store adt.Store) (*StateSummary, *builtin.M
 	} else {
 		var vcap abi.StoragePower
 		err = verifiers.ForEach(&vcap, func(key string) error {
-			verifier, err := addr.NewFromBytes([]byte(key))
+			verifier, err := adt.ParseAddrKey(key)
 			if err != nil {
 				return err
 			}
@@ -46,7 +46,7 @@ func CheckStateInvariants(st *State, store adt.Store) (*StateSummary, *builtin.M
 	} else {
 		var ccap abi.StoragePower
 		err = clients.ForEach(&ccap, func(key string) error {
-			client, err := addr.NewFromBytes([]byte(key))
+			client, err := adt.ParseAddrKey(key)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,66 @@
+package nv13
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	init4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/init"
+	cid "github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	init5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/init"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+)
+
+// Builds the reverse index of ID to robust address from the unchanged address map.
+type initMigrator struct{}
+
+func (m initMigrator) migrateState(ctx context.Context, store cbor.IpldStore, in actorMigrationInput) (*actorMigrationResult, error) {
+	var inState init4.State
+	if err := store.Get(ctx, in.head, &inState); err != nil {
+		return nil, err
+	}
+
+	adtStore := adt5.WrapStore(ctx, store)
+	addressMap, err := adt5.AsMap(adtStore, inState.AddressMap, builtin5.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load address map: %w", err)
+	}
+	robustAddressMap, err := adt5.MakeEmptyMap(adtStore, builtin5.DefaultHamtBitwidth)
+	if err != nil {
+		return nil, err
+	}
+	var actorID cbg.CborInt
+	if err := addressMap.ForEach(&actorID, func(key string) error {
+		robust, err := adt5.ParseAddrKey(key)
+		if err != nil {
+			return err
+		}
+		return robustAddressMap.Put(abi.UIntKey(uint64(actorID)), &robust)
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to index address map: %w", err)
+	}
+	robustAddressMapOut, err := robustAddressMap.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	outState := init5.State{
+		AddressMap:       inState.AddressMap,
+		RobustAddressMap: robustAddressMapOut,
+		NextID:           inState.NextID,
+		NetworkName:      inState.NetworkName,
+	}
+	newHead, err := store.Put(ctx, &outState)
+	return &actorMigrationResult{
+		newCodeCID: m.migratedCodeCID(),
+		newHead:    newHead,
+	}, err
+}
+
+func (m initMigrator) migratedCodeCID() cid.Cid {
+	return builtin5.InitActorCodeID
+}
@@ -0,0 +1,91 @@
+package nv13
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	market4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/market"
+	cid "github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	market5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/market"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+)
+
+// Builds the indexes of deals by provider and by client from the unchanged deal proposals.
+type marketMigrator struct{}
+
+func (m marketMigrator) migrateState(ctx context.Context, store cbor.IpldStore, in actorMigrationInput) (*actorMigrationResult, error) {
+	var inState market4.State
+	if err := store.Get(ctx, in.head, &inState); err != nil {
+		return nil, err
+	}
+
+	providerDealsCidOut, clientDealsCidOut, err := m.buildDealIndexes(adt5.WrapStore(ctx, store), inState.Proposals)
+	if err != nil {
+		return nil, err
+	}
+
+	outState := market5.State{
+		Proposals:                     inState.Proposals,
+		States:                        inState.States,
+		PendingProposals:              inState.PendingProposals,
+		EscrowTable:                   inState.EscrowTable,
+		LockedTable:                   inState.LockedTable,
+		NextID:                        inState.NextID,
+		DealOpsByEpoch:                inState.DealOpsByEpoch,
+		LastCron:                      inState.LastCron,
+		ProviderDeals:                 providerDealsCidOut,
+		ClientDeals:                   clientDealsCidOut,
+		TotalClientLockedCollateral:   inState.TotalClientLockedCollateral,
+		TotalProviderLockedCollateral: inState.TotalProviderLockedCollateral,
+		TotalClientStorageFee:         inState.TotalClientStorageFee,
+	}
+
+	newHead, err := store.Put(ctx, &outState)
+	return &actorMigrationResult{
+		newCodeCID: m.migratedCodeCID(),
+		newHead:    newHead,
+	}, err
+}
+
+func (m marketMigrator) migratedCodeCID() cid.Cid {
+	return builtin5.StorageMarketActorCodeID
+}
+
+func (m marketMigrator) buildDealIndexes(store adt5.Store, proposalsRoot cid.Cid) (providerRoot, clientRoot cid.Cid, err error) {
+	proposals, err := market5.AsDealProposalArray(store, proposalsRoot)
+	if err != nil {
+		return cid.Undef, cid.Undef, xerrors.Errorf("failed to load deal proposals: %w", err)
+	}
+	providerDeals, err := adt5.MakeEmptyMultimap(store, builtin5.DefaultHamtBitwidth, market5.ProposalsAmtBitwidth)
+	if err != nil {
+		return cid.Undef, cid.Undef, err
+	}
+	clientDeals, err := adt5.MakeEmptyMultimap(store, builtin5.DefaultHamtBitwidth, market5.ProposalsAmtBitwidth)
+	if err != nil {
+		return cid.Undef, cid.Undef, err
+	}
+
+	var proposal market5.DealProposal
+	if err := proposals.ForEach(&proposal, func(id int64) error {
+		value := cbg.CborInt(id)
+		if err := providerDeals.Put(abi.AddrKey(proposal.Provider), uint64(id), &value); err != nil {
+			return err
+		}
+		return clientDeals.Put(abi.AddrKey(proposal.Client), uint64(id), &value)
+	}); err != nil {
+		return cid.Undef, cid.Undef, xerrors.Errorf("failed to index deal proposals: %w", err)
+	}
+
+	if providerRoot, err = providerDeals.Root(); err != nil {
+		return cid.Undef, cid.Undef, err
+	}
+	if clientRoot, err = clientDeals.Root(); err != nil {
+		return cid.Undef, cid.Undef, err
+	}
+	return providerRoot, clientRoot, nil
+}
@@ -0,0 +1,59 @@
+package test_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	ipld2 "github.com/filecoin-project/specs-actors/v2/support/ipld"
+	vm4 "github.com/filecoin-project/specs-actors/v4/support/vm"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	init5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/init"
+	"github.com/filecoin-project/specs-actors/v5/actors/migration/nv13"
+	states5 "github.com/filecoin-project/specs-actors/v5/actors/states"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+)
+
+func TestInitMigrationIndexesRobustAddresses(t *testing.T) {
+	ctx := context.Background()
+	log := nv13.TestLogger{TB: t}
+	bs := ipld2.NewSyncBlockStoreInMemory()
+	vm := vm4.NewVMWithSingletons(ctx, t, bs)
+	robust := vm4.CreateAccounts(ctx, t, vm, 3, big.Zero(), 93837778)
+	// Checkpoints the VM so the state root includes the new accounts.
+	_, err := vm.GetStateTree()
+	require.NoError(t, err)
+
+	adtStore := adt5.WrapStore(ctx, cbor.NewCborStore(bs))
+	endRoot, err := nv13.MigrateStateTree(ctx, adtStore, vm.StateRoot(), abi.ChainEpoch(0), nv13.Config{MaxWorkers: 1}, log, nv13.NewMemMigrationCache())
+	require.NoError(t, err)
+
+	tree, err := states5.LoadTree(adtStore, endRoot)
+	require.NoError(t, err)
+	initActor, found, err := tree.GetActor(builtin5.InitActorAddr)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, builtin5.InitActorCodeID, initActor.Code)
+
+	var st init5.State
+	require.NoError(t, adtStore.Get(ctx, initActor.Head, &st))
+	for _, a := range robust {
+		idAddr, found, err := st.ResolveAddress(adtStore, a)
+		require.NoError(t, err)
+		require.True(t, found)
+
+		reversed, found, err := st.LookupRobust(adtStore, idAddr)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, a, reversed)
+	}
+
+	_, msgs := init5.CheckStateInvariants(&st, adtStore)
+	assert.True(t, msgs.IsEmpty(), strings.Join(msgs.Messages(), "\n"))
+}
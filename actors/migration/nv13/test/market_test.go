@@ -0,0 +1,91 @@
+package test_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	ipld2 "github.com/filecoin-project/specs-actors/v2/support/ipld"
+	builtin4 "github.com/filecoin-project/specs-actors/v4/actors/builtin"
+	market4 "github.com/filecoin-project/specs-actors/v4/actors/builtin/market"
+	vm4 "github.com/filecoin-project/specs-actors/v4/support/vm"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	market5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/v5/actors/migration/nv13"
+	states5 "github.com/filecoin-project/specs-actors/v5/actors/states"
+	adt5 "github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestMarketMigrationIndexesDeals(t *testing.T) {
+	ctx := context.Background()
+	log := nv13.TestLogger{TB: t}
+	bs := ipld2.NewSyncBlockStoreInMemory()
+	vm := vm4.NewVMWithSingletons(ctx, t, bs)
+
+	provider1, provider2 := tutil.NewIDAddr(t, 1001), tutil.NewIDAddr(t, 1002)
+	client1, client2 := tutil.NewIDAddr(t, 1003), tutil.NewIDAddr(t, 1004)
+
+	// Write some deal proposals directly into the prior market state.
+	var st4 market4.State
+	require.NoError(t, vm.GetState(builtin4.StorageMarketActorAddr, &st4))
+	proposals, err := market4.AsDealProposalArray(vm.Store(), st4.Proposals)
+	require.NoError(t, err)
+	for i, parties := range []struct{ provider, client address.Address }{
+		{provider1, client1},
+		{provider2, client1},
+		{provider1, client2},
+	} {
+		proposal := market4.DealProposal{
+			PieceCID:             tutil.MakeCID("piece", &market5.PieceCIDPrefix),
+			PieceSize:            abi.PaddedPieceSize(2048),
+			Provider:             parties.provider,
+			Client:               parties.client,
+			StartEpoch:           100,
+			EndEpoch:             200,
+			StoragePricePerEpoch: abi.NewTokenAmount(0),
+			ProviderCollateral:   abi.NewTokenAmount(0),
+			ClientCollateral:     abi.NewTokenAmount(0),
+		}
+		require.NoError(t, proposals.Set(abi.DealID(i), &proposal))
+	}
+	st4.Proposals, err = proposals.Root()
+	require.NoError(t, err)
+	st4.NextID = 3
+	require.NoError(t, vm.SetActorState(ctx, builtin4.StorageMarketActorAddr, &st4))
+	_, err = vm.GetStateTree()
+	require.NoError(t, err)
+
+	adtStore := adt5.WrapStore(ctx, cbor.NewCborStore(bs))
+	endRoot, err := nv13.MigrateStateTree(ctx, adtStore, vm.StateRoot(), abi.ChainEpoch(0), nv13.Config{MaxWorkers: 1}, log, nv13.NewMemMigrationCache())
+	require.NoError(t, err)
+
+	tree, err := states5.LoadTree(adtStore, endRoot)
+	require.NoError(t, err)
+	marketActor, found, err := tree.GetActor(builtin5.StorageMarketActorAddr)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, builtin5.StorageMarketActorCodeID, marketActor.Code)
+
+	var st market5.State
+	require.NoError(t, adtStore.Get(ctx, marketActor.Head, &st))
+	assert.Equal(t, st4.Proposals, st.Proposals)
+
+	ids, err := st.DealsForProvider(adtStore, provider1)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.DealID{0, 2}, ids)
+	ids, err = st.DealsForProvider(adtStore, provider2)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.DealID{1}, ids)
+	ids, err = st.DealsForClient(adtStore, client1)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.DealID{0, 1}, ids)
+	ids, err = st.DealsForClient(adtStore, client2)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.DealID{2}, ids)
+}
@@ -49,7 +49,8 @@ func ActorHeadKey(addr address.Address, head cid.Cid) string {
 
 // Migrates from v12 to v13
 //
-// This migration only updates the actor code CIDs in the state tree.
+// This migration updates the actor code CIDs in the state tree, and adds the init actor's reverse address index
+// and the market actor's deal indexes.
 // MigrationCache stores and loads cached data. Its implementation must be threadsafe
 type MigrationCache interface {
 	Write(key string, newCid cid.Cid) error
@@ -68,11 +69,11 @@ func MigrateStateTree(ctx context.Context, store cbor.IpldStore, actorsRootIn ci
 	var migrations = map[cid.Cid]actorMigration{
 		builtin4.AccountActorCodeID:          nilMigrator{builtin5.AccountActorCodeID},
 		builtin4.CronActorCodeID:             nilMigrator{builtin5.CronActorCodeID},
-		builtin4.InitActorCodeID:             nilMigrator{builtin5.InitActorCodeID},
+		builtin4.InitActorCodeID:             initMigrator{},
 		builtin4.MultisigActorCodeID:         nilMigrator{builtin5.MultisigActorCodeID},
 		builtin4.PaymentChannelActorCodeID:   nilMigrator{builtin5.PaymentChannelActorCodeID},
 		builtin4.RewardActorCodeID:           nilMigrator{builtin5.RewardActorCodeID},
-		builtin4.StorageMarketActorCodeID:    nilMigrator{builtin5.StorageMarketActorCodeID},
+		builtin4.StorageMarketActorCodeID:    marketMigrator{},
 		builtin4.StorageMinerActorCodeID:     nilMigrator{builtin5.StorageMinerActorCodeID},
 		builtin4.StoragePowerActorCodeID:     nilMigrator{builtin5.StoragePowerActorCodeID},
 		builtin4.SystemActorCodeID:           nilMigrator{builtin5.SystemActorCodeID},
@@ -78,7 +78,7 @@ func (t *Tree) SetActor(addr address.Address, actor *Actor) error {
 func (t *Tree) ForEach(fn func(addr address.Address, actor *Actor) error) error {
 	var val Actor
 	return t.Map.ForEach(&val, func(key string) error {
-		addr, err := address.NewFromBytes([]byte(key))
+		addr, err := adt.ParseAddrKey(key)
 		if err != nil {
 			return err
 		}
@@ -89,7 +89,7 @@ func (t *Tree) ForEach(fn func(addr address.Address, actor *Actor) error) error
 // Traverses all keys in the tree, without decoding the actor states.
 func (t *Tree) ForEachKey(fn func(addr address.Address) error) error {
 	return t.Map.ForEach(nil, func(key string) error {
-		addr, err := address.NewFromBytes([]byte(key))
+		addr, err := adt.ParseAddrKey(key)
 		if err != nil {
 			return err
 		}
@@ -2,6 +2,10 @@ package adt
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"math"
+	"sort"
 
 	amt "github.com/filecoin-project/go-amt-ipld/v3"
 
@@ -15,8 +19,11 @@ var DefaultAmtOptions = []amt.Option{}
 
 // Array stores a sparse sequence of values in an AMT.
 type Array struct {
-	root  *amt.Root
-	store Store
+	lastCid  cid.Cid
+	root     *amt.Root
+	store    Store
+	bitwidth int
+	dirty    bool // Whether the root has been mutated since lastCid was loaded or written.
 }
 
 // AsArray interprets a store as an AMT-based array with root `r`.
@@ -28,8 +35,10 @@ func AsArray(s Store, r cid.Cid, bitwidth int) (*Array, error) {
 	}
 
 	return &Array{
-		root:  root,
-		store: s,
+		lastCid:  r,
+		root:     root,
+		store:    s,
+		bitwidth: bitwidth,
 	}, nil
 }
 
@@ -41,8 +50,9 @@ func MakeEmptyArray(s Store, bitwidth int) (*Array, error) {
 		return nil, err
 	}
 	return &Array{
-		root:  root,
-		store: s,
+		root:     root,
+		store:    s,
+		bitwidth: bitwidth,
 	}, nil
 }
 
@@ -57,21 +67,71 @@ func StoreEmptyArray(s Store, bitwidth int) (cid.Cid, error) {
 
 // Returns the root CID of the underlying AMT.
 func (a *Array) Root() (cid.Cid, error) {
-	return a.root.Flush(a.store.Context())
+	c, err := a.root.Flush(a.store.Context())
+	if err != nil {
+		return cid.Undef, err
+	}
+	a.lastCid = c
+	a.dirty = false
+	return c, nil
+}
+
+// Returns an independent copy of the array, such that mutations to either do not affect the other.
+// Pending changes are first flushed to the store, and the copy is loaded from the resulting root,
+// sharing all stored nodes with the original.
+func (a *Array) Copy() (*Array, error) {
+	r, err := a.Root()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to flush array to copy: %w", err)
+	}
+	return AsArray(a.store, r, a.bitwidth)
 }
 
 // Appends a value to the end of the array. Assumes continuous array.
 // If the array isn't continuous use Set and a separate counter
 func (a *Array) AppendContinuous(value cbor.Marshaler) error {
+	a.dirty = true
 	if err := a.root.Set(a.store.Context(), a.root.Len(), value); err != nil {
-		return xerrors.Errorf("append failed to set index %v value %v in root %v: %w", a.root.Len(), value, a.root, err)
+		return xerrors.Errorf("append failed to set index %v: %w", a.root.Len(), err)
 	}
 	return nil
 }
 
+// Appends values to the end of the array at consecutive indices, returning the index of the first.
+// Assumes continuous array, as for AppendContinuous.
+func (a *Array) BatchAppendContinuous(values []cbor.Marshaler) (uint64, error) {
+	first := a.root.Len()
+	for j, value := range values {
+		i := first + uint64(j)
+		a.dirty = true
+		if err := a.root.Set(a.store.Context(), i, value); err != nil {
+			return 0, xerrors.Errorf("append failed to set index %v: %w", i, err)
+		}
+	}
+	return first, nil
+}
+
 func (a *Array) Set(i uint64, value cbor.Marshaler) error {
+	a.dirty = true
 	if err := a.root.Set(a.store.Context(), i, value); err != nil {
-		return xerrors.Errorf("failed to set index %v value %v in root %v: %w", i, value, a.root, err)
+		return xerrors.Errorf("failed to set index %v: %w", i, err)
+	}
+	return nil
+}
+
+// Sets many indices at once, extending the array or overwriting existing values as necessary.
+// Changes are held in memory until the next call to Root, so a batch is flushed just once.
+// Indices are set in ascending order.
+func (a *Array) BatchSet(entries map[uint64]cbor.Marshaler) error {
+	indices := make([]uint64, 0, len(entries))
+	for i := range entries { //nolint:nomaprange
+		indices = append(indices, i)
+	}
+	sort.Slice(indices, func(x, y int) bool { return indices[x] < indices[y] })
+	for _, i := range indices {
+		if err := a.Set(i, entries[i]); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -79,8 +139,9 @@ func (a *Array) Set(i uint64, value cbor.Marshaler) error {
 // Removes the value at index `i` from the AMT, if it exists.
 // Returns whether the index was previously present.
 func (a *Array) TryDelete(i uint64) (bool, error) {
+	a.dirty = true
 	if found, err := a.root.Delete(a.store.Context(), i); err != nil {
-		return false, xerrors.Errorf("array delete failed to delete index %v in root %v: %w", i, a.root, err)
+		return false, xerrors.Errorf("array delete failed to delete index %v: %w", i, err)
 	} else {
 		return found, nil
 	}
@@ -88,26 +149,76 @@ func (a *Array) TryDelete(i uint64) (bool, error) {
 
 // Removes the value at index `i` from the AMT, expecting it to exist.
 func (a *Array) Delete(i uint64) error {
+	a.dirty = true
 	if found, err := a.root.Delete(a.store.Context(), i); err != nil {
-		return xerrors.Errorf("failed to delete index %v in root %v: %w", i, a.root, err)
+		return xerrors.Errorf("failed to delete index %v: %w", i, err)
 	} else if !found {
-		return xerrors.Errorf("no such index %v in root %v to delete: %w", i, a.root, err)
+		return xerrors.Errorf("no such index %v to delete: %w", i, ErrNotFound)
 	}
 	return nil
 }
 
 func (a *Array) BatchDelete(ix []uint64, strict bool) error {
+	a.dirty = true
 	if _, err := a.root.BatchDelete(a.store.Context(), ix, strict); err != nil {
 		return xerrors.Errorf("failed to batch delete keys %v: %w", ix, err)
 	}
 	return nil
 }
 
+// Removes all populated entries with indices in the half-open range [start, end).
+// Unpopulated indices in the range are skipped. Returns the number of entries removed.
+func (a *Array) DeleteRange(start, end uint64) (uint64, error) {
+	var indices []uint64
+	if err := a.forEachInRange(start, end, func(i uint64, _ *cbg.Deferred) error {
+		indices = append(indices, i)
+		return nil
+	}); err != nil {
+		return 0, xerrors.Errorf("failed to find indices in range [%v, %v): %w", start, end, err)
+	}
+	if err := a.BatchDelete(indices, true); err != nil {
+		return 0, err
+	}
+	return uint64(len(indices)), nil
+}
+
+// Exchanges the values at indices `i` and `j`. If only one is populated, its value moves to the other index
+// and it is left unpopulated. Swapping two unpopulated indices, or an index with itself, is a no-op.
+func (a *Array) Swap(i, j uint64) error {
+	if i == j {
+		return nil
+	}
+	var vi, vj cbg.Deferred
+	foundI, err := a.root.Get(a.store.Context(), i, &vi)
+	if err != nil {
+		return xerrors.Errorf("failed to get index %v: %w", i, err)
+	}
+	foundJ, err := a.root.Get(a.store.Context(), j, &vj)
+	if err != nil {
+		return xerrors.Errorf("failed to get index %v: %w", j, err)
+	}
+	if err := a.moveTo(j, &vi, foundI); err != nil {
+		return err
+	}
+	return a.moveTo(i, &vj, foundJ)
+}
+
+// Sets index `i` to `value` if `present`, otherwise deletes any value at `i`.
+func (a *Array) moveTo(i uint64, value *cbg.Deferred, present bool) error {
+	if present {
+		return a.Set(i, value)
+	}
+	_, err := a.TryDelete(i)
+	return err
+}
+
 // Iterates all entries in the array, deserializing each value in turn into `out` and then calling a function.
 // Iteration halts if the function returns an error.
 // If the output parameter is nil, deserialization is skipped.
+// If the store is a BatchStore and the array has no pending changes, the children of each node are fetched
+// together with a single GetMany before descending into them.
 func (a *Array) ForEach(out cbor.Unmarshaler, fn func(i int64) error) error {
-	return a.root.ForEach(a.store.Context(), func(k uint64, val *cbg.Deferred) error {
+	cb := func(k uint64, val *cbg.Deferred) error {
 		if out != nil {
 			if deferred, ok := out.(*cbg.Deferred); ok {
 				// fast-path deferred -> deferred to avoid re-decoding.
@@ -117,9 +228,194 @@ func (a *Array) ForEach(out cbor.Unmarshaler, fn func(i int64) error) error {
 			}
 		}
 		return fn(int64(k))
+	}
+	if _, ok := a.store.(BatchStore); ok && a.lastCid.Defined() && !a.dirty {
+		return a.forEachPrefetched(cb)
+	}
+	return a.root.ForEach(a.store.Context(), cb)
+}
+
+// Iterates all entries in index order, reading nodes from the store by their links, starting from lastCid.
+// All the children of a node are fetched with a single GetMany.
+func (a *Array) forEachPrefetched(cb func(i uint64, val *cbg.Deferred) error) error {
+	var root amtRoot
+	if err := a.store.Get(a.store.Context(), a.lastCid, &root); err != nil {
+		return xerrors.Errorf("failed to load array root %v: %w", a.lastCid, err)
+	}
+	return a.forEachPrefetchedNode(&root.node, root.height, 0, cb)
+}
+
+func (a *Array) forEachPrefetchedNode(nd *amtNode, height, offset uint64, cb func(i uint64, val *cbg.Deferred) error) error {
+	width := uint64(1) << uint(a.bitwidth)
+	if height == 0 {
+		next := 0
+		for x := uint64(0); x < width && next < len(nd.values); x++ {
+			if nd.isSet(x) {
+				if err := cb(offset+x, nd.values[next]); err != nil {
+					return err
+				}
+				next++
+			}
+		}
+		return nil
+	}
+
+	children := make([]amtNode, len(nd.links))
+	targets := make([]interface{}, len(nd.links))
+	for i := range children {
+		targets[i] = &children[i]
+	}
+	if err := GetMany(a.store.Context(), a.store, nd.links, targets); err != nil {
+		return xerrors.Errorf("failed to load child nodes: %w", err)
+	}
+	// Each child at this height spans width^height indices.
+	span := uint64(math.MaxUint64)
+	if shift := uint64(a.bitwidth) * height; shift < 64 {
+		span = 1 << shift
+	}
+	next := 0
+	for x := uint64(0); x < width && next < len(children); x++ {
+		if nd.isSet(x) {
+			if err := a.forEachPrefetchedNode(&children[next], height-1, offset+x*span, cb); err != nil {
+				return err
+			}
+			next++
+		}
+	}
+	return nil
+}
+
+// Iterates the populated entries with indices in the window [start, start+count), decoding each value
+// into a fresh object obtained from newValue and then calling a function with the index and value.
+// Only the parts of the tree overlapping the window are loaded.
+// Iteration halts if the function returns an error, and stops without error if it returns StopIteration.
+func (a *Array) Slice(start, count uint64, newValue func() cbor.Unmarshaler, fn func(i uint64, value cbor.Unmarshaler) error) error {
+	end := start + count
+	if end < start {
+		end = math.MaxUint64
+	}
+	err := a.forEachInRange(start, end, func(i uint64, val *cbg.Deferred) error {
+		value := newValue()
+		if err := value.UnmarshalCBOR(bytes.NewReader(val.Raw)); err != nil {
+			return err
+		}
+		return fn(i, value)
 	})
+	if xerrors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
 }
 
+// Iterates the populated entries with indices in the half-open range [start, end), deserializing each value
+// in turn into `out` (if non-nil) and then calling a function.
+// Only the parts of the tree overlapping the range are loaded.
+// Iteration halts if the function returns an error, and stops without error if it returns StopIteration.
+func (a *Array) ForEachRange(start, end uint64, out cbor.Unmarshaler, fn func(i uint64) error) error {
+	err := a.forEachInRange(start, end, func(i uint64, val *cbg.Deferred) error {
+		if out != nil {
+			if deferred, ok := out.(*cbg.Deferred); ok {
+				*deferred = *val
+			} else if err := out.UnmarshalCBOR(bytes.NewReader(val.Raw)); err != nil {
+				return err
+			}
+		}
+		return fn(i)
+	})
+	if xerrors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
+}
+
+// Iterates the populated entries with indices in [start, end), stopping as soon as an index beyond the range
+// is reached.
+func (a *Array) forEachInRange(start, end uint64, cb func(i uint64, val *cbg.Deferred) error) error {
+	if end <= start {
+		return nil
+	}
+	endErr := errors.New("end of range")
+	err := a.root.ForEachAt(a.store.Context(), start, func(i uint64, val *cbg.Deferred) error {
+		if i >= end {
+			return endErr
+		}
+		return cb(i, val)
+	})
+	if err == endErr {
+		return nil
+	}
+	return err
+}
+
+// Collects the populated indices of the array in ascending order, without deserializing values.
+func (a *Array) Indices() ([]uint64, error) {
+	out := make([]uint64, 0, a.root.Len())
+	err := a.root.ForEach(a.store.Context(), func(i uint64, _ *cbg.Deferred) error {
+		out = append(out, i)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to collect indices: %w", err)
+	}
+	return out, nil
+}
+
+// Builds a new array, with the same populated indices and bitwidth, holding values produced by `transform` from
+// each serialized value of this array. The original array is not modified, and the new array is not written to
+// the store until its Root is requested.
+func (a *Array) MapValues(transform func(i uint64, raw []byte) (cbor.Marshaler, error)) (*Array, error) {
+	result, err := MakeEmptyArray(a.store, a.bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	ctx := a.store.Context()
+	err = a.root.ForEach(ctx, func(i uint64, val *cbg.Deferred) error {
+		v, err := transform(i, val.Raw)
+		if err != nil {
+			return xerrors.Errorf("failed to transform value at index %v: %w", i, err)
+		}
+		return result.Set(i, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Builds a new array, with the same bitwidth, holding just the entries for which `keep` returns true, re-indexed
+// contiguously from zero in their original order. Returns the new array and the original index of each of its entries.
+// Each value is first deserialized into `out` (if non-nil), from which `keep` may read it. Kept values are copied
+// without re-encoding. The original array is not modified.
+func (a *Array) Compact(out cbor.Unmarshaler, keep func(i uint64) bool) (*Array, []uint64, error) {
+	result, err := MakeEmptyArray(a.store, a.bitwidth)
+	if err != nil {
+		return nil, nil, err
+	}
+	var oldIndices []uint64
+	err = a.root.ForEach(a.store.Context(), func(i uint64, val *cbg.Deferred) error {
+		if out != nil {
+			if err := out.UnmarshalCBOR(bytes.NewReader(val.Raw)); err != nil {
+				return err
+			}
+		}
+		if !keep(i) {
+			return nil
+		}
+		if err := result.Set(uint64(len(oldIndices)), val); err != nil {
+			return err
+		}
+		oldIndices = append(oldIndices, i)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, oldIndices, nil
+}
+
+// Returns the number of populated entries in the array.
+// The count is tracked in the AMT root, so this doesn't traverse the tree. Because the array is sparse,
+// the count may be less than one more than the highest populated index.
 func (a *Array) Length() uint64 {
 	return a.root.Len()
 }
@@ -128,25 +424,201 @@ func (a *Array) Length() uint64 {
 //  indicating whether the element was found in the array
 func (a *Array) Get(k uint64, out cbor.Unmarshaler) (bool, error) {
 	if found, err := a.root.Get(a.store.Context(), k, out); err != nil {
-		return false, xerrors.Errorf("failed to get index %v in root %v: %w", k, a.root, err)
+		return false, xerrors.Errorf("failed to get index %v: %w", k, err)
 	} else {
 		return found, nil
 	}
 }
 
+// Retrieves the value at index `k` into `out` if populated, and otherwise populates `out` from `def`
+// by serializing and deserializing it.
+func (a *Array) GetOrDefault(k uint64, out cbor.Unmarshaler, def cbor.Marshaler) error {
+	if found, err := a.Get(k, out); err != nil {
+		return err
+	} else if found {
+		return nil
+	}
+	if err := copyCBOR(out, def); err != nil {
+		return xerrors.Errorf("failed to copy default for index %v: %w", k, err)
+	}
+	return nil
+}
+
 // Retrieves an array value into the 'out' unmarshaler (if non-nil), and removes the entry.
 // Returns a boolean indicating whether the element was previously in the array.
 func (a *Array) Pop(k uint64, out cbor.Unmarshaler) (bool, error) {
 	if found, err := a.root.Get(a.store.Context(), k, out); err != nil {
-		return false, xerrors.Errorf("failed to get index %v in root %v: %w", k, a.root, err)
+		return false, xerrors.Errorf("failed to get index %v: %w", k, err)
 	} else if !found {
 		return false, nil
 	}
 
+	a.dirty = true
 	if found, err := a.root.Delete(a.store.Context(), k); err != nil {
-		return false, xerrors.Errorf("failed to delete index %v in root %v: %w", k, a.root, err)
+		return false, xerrors.Errorf("failed to delete index %v: %w", k, err)
 	} else if !found {
-		return false, xerrors.Errorf("can't find index %v to delete in root %v", k, a.root)
+		return false, xerrors.Errorf("can't find index %v to delete: %w", k, ErrNotFound)
 	}
 	return true, nil
 }
+
+// Retrieves the value at the highest populated index into the 'out' unmarshaler (if non-nil), and removes the entry.
+// Returns the index and a boolean indicating whether the array was non-empty.
+func (a *Array) PopLast(out cbor.Unmarshaler) (uint64, bool, error) {
+	i, found, err := a.lastIndex()
+	if err != nil {
+		return 0, false, err
+	} else if !found {
+		return 0, false, nil
+	}
+	if _, err := a.Pop(i, out); err != nil {
+		return 0, false, err
+	}
+	return i, true, nil
+}
+
+// Finds the highest populated index by binary search over the index space.
+// Nodes loaded by earlier probes are cached by the AMT, so this touches about one path of the tree.
+func (a *Array) lastIndex() (uint64, bool, error) {
+	if a.root.Len() == 0 {
+		return 0, false, nil
+	}
+	// Invariant: lo is populated and no index at or beyond hi is populated.
+	lo, err := a.root.FirstSetIndex(a.store.Context())
+	if err != nil {
+		return 0, false, xerrors.Errorf("failed to find first index: %w", err)
+	}
+	hi := uint64(math.MaxUint64)
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		next, found, err := a.nextIndex(mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if found {
+			lo = next
+		} else {
+			hi = mid
+		}
+	}
+	return lo, true, nil
+}
+
+// Finds the lowest populated index at or beyond `start`.
+func (a *Array) nextIndex(start uint64) (uint64, bool, error) {
+	var next uint64
+	found := false
+	stopErr := errors.New("stop")
+	err := a.root.ForEachAt(a.store.Context(), start, func(i uint64, _ *cbg.Deferred) error {
+		next = i
+		found = true
+		return stopErr
+	})
+	if err != nil && err != stopErr {
+		return 0, false, xerrors.Errorf("failed to find index from %v: %w", start, err)
+	}
+	return next, found, nil
+}
+
+// The serialized form of an AMT root, as decoded by the AMT library, which doesn't export it.
+// Only what's needed for traversal is retained. Agreement with the library is checked by
+// TestArrayForEachPrefetchedMatchesAMT, which must be kept passing across library upgrades.
+type amtRoot struct {
+	height uint64
+	node   amtNode
+}
+
+// The serialized form of an AMT node: a bitmap of populated slots, and either links to the child nodes
+// or the values in those slots.
+type amtNode struct {
+	bmap   []byte
+	links  []cid.Cid
+	values []*cbg.Deferred
+}
+
+func (n *amtNode) isSet(x uint64) bool {
+	return x/8 < uint64(len(n.bmap)) && n.bmap[x/8]&(1<<(x%8)) != 0
+}
+
+func (r *amtRoot) UnmarshalCBOR(rd io.Reader) error {
+	br := cbg.GetPeeker(rd)
+	scratch := make([]byte, 8)
+	if err := readArrayHeader(br, scratch, 4); err != nil {
+		return xerrors.Errorf("invalid array root: %w", err)
+	}
+	// Bitwidth, height, count.
+	var fields [3]uint64
+	for i := range fields {
+		maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return xerrors.Errorf("invalid array root: expected unsigned int, got major type %d", maj)
+		}
+		fields[i] = extra
+	}
+	r.height = fields[1]
+	return r.node.UnmarshalCBOR(br)
+}
+
+func (n *amtNode) UnmarshalCBOR(rd io.Reader) error {
+	br := cbg.GetPeeker(rd)
+	scratch := make([]byte, 8)
+	if err := readArrayHeader(br, scratch, 3); err != nil {
+		return xerrors.Errorf("invalid array node: %w", err)
+	}
+	bmap, err := cbg.ReadByteArray(br, cbg.ByteArrayMaxLen)
+	if err != nil {
+		return xerrors.Errorf("invalid array node bitmap: %w", err)
+	}
+	n.bmap = bmap
+
+	count, err := readArrayLength(br, scratch)
+	if err != nil {
+		return xerrors.Errorf("invalid array node links: %w", err)
+	}
+	n.links = make([]cid.Cid, count)
+	for i := range n.links {
+		if n.links[i], err = cbg.ReadCid(br); err != nil {
+			return xerrors.Errorf("invalid array node link: %w", err)
+		}
+	}
+
+	if count, err = readArrayLength(br, scratch); err != nil {
+		return xerrors.Errorf("invalid array node values: %w", err)
+	}
+	n.values = make([]*cbg.Deferred, count)
+	for i := range n.values {
+		n.values[i] = new(cbg.Deferred)
+		if err := n.values[i].UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("invalid array node value: %w", err)
+		}
+	}
+	return nil
+}
+
+func readArrayHeader(br io.Reader, scratch []byte, length uint64) error {
+	count, err := readArrayLength(br, scratch)
+	if err != nil {
+		return err
+	}
+	if count != length {
+		return xerrors.Errorf("expected %d fields, got %d", length, count)
+	}
+	return nil
+}
+
+func readArrayLength(br io.Reader, scratch []byte) (uint64, error) {
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return 0, err
+	}
+	if maj != cbg.MajArray {
+		return 0, xerrors.Errorf("expected array, got major type %d", maj)
+	}
+	if extra > cbg.MaxLength {
+		return 0, xerrors.Errorf("array too large (%d)", extra)
+	}
+	return extra, nil
+}
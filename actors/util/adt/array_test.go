@@ -1,13 +1,26 @@
 package adt_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
 	"testing"
 
 	"github.com/filecoin-project/go-address"
+	amt "github.com/filecoin-project/go-amt-ipld/v3"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/cbor"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
 	"github.com/filecoin-project/specs-actors/v5/support/mock"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
 )
 
 func TestArrayNotFound(t *testing.T) {
@@ -20,3 +33,728 @@ func TestArrayNotFound(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, found)
 }
+
+func TestArrayDeleteNotFound(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+
+	err = arr.Delete(7)
+	require.Error(t, err)
+	assert.True(t, xerrors.Is(err, adt.ErrNotFound))
+}
+
+func TestArrayLength(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), arr.Length())
+
+	// Populate a sparse set of indices, with gaps spanning several levels of the tree.
+	v := abi.NewTokenAmount(1)
+	for _, i := range []uint64{0, 5, 100, 1000, 1 << 20} {
+		require.NoError(t, arr.Set(i, &v))
+	}
+	assert.Equal(t, uint64(5), arr.Length())
+
+	// Overwriting doesn't change the count.
+	require.NoError(t, arr.Set(100, &v))
+	assert.Equal(t, uint64(5), arr.Length())
+
+	require.NoError(t, arr.Delete(5))
+	assert.Equal(t, uint64(4), arr.Length())
+
+	// The count survives a round trip through the store.
+	r, err := arr.Root()
+	require.NoError(t, err)
+	arr, err = adt.AsArray(store, r, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), arr.Length())
+}
+
+func TestArrayBatchSet(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	batched, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	looped, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+
+	initial := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 10; i++ {
+		require.NoError(t, batched.Set(i, &initial))
+		require.NoError(t, looped.Set(i, &initial))
+	}
+
+	// The batch both overwrites existing indices and extends the array.
+	entries := map[uint64]cbor.Marshaler{}
+	for i := uint64(5); i < 50; i += 3 {
+		v := abi.NewTokenAmount(int64(i))
+		entries[i] = &v
+		require.NoError(t, looped.Set(i, &v))
+	}
+	require.NoError(t, batched.BatchSet(entries))
+	assert.Equal(t, looped.Length(), batched.Length())
+	assert.Equal(t, tutil.MustRoot(t, looped), tutil.MustRoot(t, batched))
+
+	var out abi.TokenAmount
+	found, err := batched.Get(8, &out)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, abi.NewTokenAmount(8), out)
+}
+
+func BenchmarkArraySetFlushEach(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	v := abi.NewTokenAmount(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		arr, err := adt.MakeEmptyArray(store, 5)
+		require.NoError(b, err)
+		for j := uint64(0); j < 1000; j++ {
+			require.NoError(b, arr.Set(j, &v))
+			_, err = arr.Root()
+			require.NoError(b, err)
+		}
+	}
+}
+
+func BenchmarkArrayBatchSet(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	v := abi.NewTokenAmount(1)
+	entries := make(map[uint64]cbor.Marshaler, 1000)
+	for j := uint64(0); j < 1000; j++ {
+		entries[j] = &v
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		arr, err := adt.MakeEmptyArray(store, 5)
+		require.NoError(b, err)
+		require.NoError(b, arr.BatchSet(entries))
+		_, err = arr.Root()
+		require.NoError(b, err)
+	}
+}
+
+func TestArrayBatchAppendContinuous(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+
+	var values []cbor.Marshaler
+	for i := int64(0); i < 10; i++ {
+		v := abi.NewTokenAmount(i)
+		values = append(values, &v)
+	}
+
+	first, err := arr.BatchAppendContinuous(values[:4])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), first)
+	first, err = arr.BatchAppendContinuous(values[4:])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), first)
+	assert.Equal(t, uint64(10), arr.Length())
+
+	var out abi.TokenAmount
+	err = arr.ForEach(&out, func(i int64) error {
+		assert.Equal(t, abi.NewTokenAmount(i), out)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// An empty batch appends nothing.
+	first, err = arr.BatchAppendContinuous(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), first)
+	assert.Equal(t, uint64(10), arr.Length())
+}
+
+func TestArraySlice(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	for i := uint64(0); i < 300; i += 10 {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, arr.Set(i, &v))
+	}
+
+	collect := func(start, count uint64) []uint64 {
+		var indices []uint64
+		newValue := func() cbor.Unmarshaler { return new(abi.TokenAmount) }
+		err := arr.Slice(start, count, newValue, func(i uint64, value cbor.Unmarshaler) error {
+			assert.Equal(t, abi.NewTokenAmount(int64(i)), *value.(*abi.TokenAmount))
+			indices = append(indices, i)
+			return nil
+		})
+		require.NoError(t, err)
+		return indices
+	}
+
+	// Unset indices within the window are skipped.
+	assert.Equal(t, []uint64{100, 110, 120, 130, 140}, collect(95, 50))
+	assert.Equal(t, []uint64{100}, collect(100, 10))
+	assert.Empty(t, collect(101, 9))
+	assert.Empty(t, collect(100, 0))
+	assert.Empty(t, collect(1000, 100))
+	assert.Equal(t, []uint64{280, 290}, collect(280, math.MaxUint64))
+
+	// Iteration stops early on StopIteration.
+	var visited []uint64
+	err = arr.Slice(0, 300, func() cbor.Unmarshaler { return new(abi.TokenAmount) }, func(i uint64, _ cbor.Unmarshaler) error {
+		visited = append(visited, i)
+		if len(visited) == 3 {
+			return adt.StopIteration
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 10, 20}, visited)
+}
+
+func TestArrayForEachRange(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 2)
+	require.NoError(t, err)
+	// Two clusters of indices in separate subtrees.
+	populated := []uint64{3, 4, 5, 6, 200, 201, 202}
+	for _, i := range populated {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, arr.Set(i, &v))
+	}
+
+	collect := func(start, end uint64) []uint64 {
+		var indices []uint64
+		var out abi.TokenAmount
+		require.NoError(t, arr.ForEachRange(start, end, &out, func(i uint64) error {
+			assert.Equal(t, abi.NewTokenAmount(int64(i)), out)
+			indices = append(indices, i)
+			return nil
+		}))
+		return indices
+	}
+
+	assert.Equal(t, populated, collect(0, 1000))
+	// Ranges straddling populated indices.
+	assert.Equal(t, []uint64{5, 6, 200}, collect(5, 201))
+	assert.Equal(t, []uint64{3}, collect(0, 4))
+	assert.Equal(t, []uint64{202}, collect(202, 203))
+	// Ranges missing all populated indices.
+	assert.Empty(t, collect(7, 200))
+	assert.Empty(t, collect(203, 1000))
+	assert.Empty(t, collect(6, 6))
+	assert.Empty(t, collect(10, 5))
+
+	// Stopping early, as when scanning a queue up to the current epoch.
+	var visited []uint64
+	require.NoError(t, arr.ForEachRange(0, 1000, nil, func(i uint64) error {
+		if i > 5 {
+			return adt.StopIteration
+		}
+		visited = append(visited, i)
+		return nil
+	}))
+	assert.Equal(t, []uint64{3, 4, 5}, visited)
+
+	// Other errors are propagated.
+	failure := xerrors.New("failure")
+	err = arr.ForEachRange(0, 1000, nil, func(i uint64) error { return failure })
+	assert.True(t, xerrors.Is(err, failure))
+}
+
+func TestArrayPopLast(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+
+	t.Run("empty", func(t *testing.T) {
+		_, found, err := arr.PopLast(nil)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("single element", func(t *testing.T) {
+		v := abi.NewTokenAmount(7)
+		require.NoError(t, arr.Set(0, &v))
+		var out abi.TokenAmount
+		i, found, err := arr.PopLast(&out)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, uint64(0), i)
+		assert.Equal(t, v, out)
+		assert.Equal(t, uint64(0), arr.Length())
+	})
+
+	t.Run("sparse", func(t *testing.T) {
+		indices := []uint64{2, 9, 64, 65, 4000, 1 << 40}
+		for _, i := range indices {
+			v := abi.NewTokenAmount(int64(i))
+			require.NoError(t, arr.Set(i, &v))
+		}
+		for j := len(indices) - 1; j >= 0; j-- {
+			var out abi.TokenAmount
+			i, found, err := arr.PopLast(&out)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, indices[j], i)
+			assert.Equal(t, abi.NewTokenAmount(int64(i)), out)
+			assert.Equal(t, uint64(j), arr.Length())
+		}
+		_, found, err := arr.PopLast(nil)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+}
+
+func TestArrayDeleteRange(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	expected, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 100; i += 3 {
+		require.NoError(t, arr.Set(i, &v))
+		if i < 10 || i >= 50 {
+			require.NoError(t, expected.Set(i, &v))
+		}
+	}
+
+	removed, err := arr.DeleteRange(10, 50)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(13), removed)
+	assert.Equal(t, expected.Length(), arr.Length())
+	assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, arr))
+
+	// Deleting an already empty range is a no-op.
+	removed, err = arr.DeleteRange(10, 50)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), removed)
+	removed, err = arr.DeleteRange(1000, 2000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), removed)
+	assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, arr))
+}
+
+func BenchmarkArrayDeleteEach(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	r := benchmarkArrayRoot(b, store)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		arr, err := adt.AsArray(store, r, 5)
+		require.NoError(b, err)
+		for j := uint64(100); j < 900; j++ {
+			_, err := arr.TryDelete(j)
+			require.NoError(b, err)
+			_, err = arr.Root()
+			require.NoError(b, err)
+		}
+	}
+}
+
+func BenchmarkArrayDeleteRange(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	r := benchmarkArrayRoot(b, store)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		arr, err := adt.AsArray(store, r, 5)
+		require.NoError(b, err)
+		_, err = arr.DeleteRange(100, 900)
+		require.NoError(b, err)
+		_, err = arr.Root()
+		require.NoError(b, err)
+	}
+}
+
+func benchmarkArrayRoot(b *testing.B, store adt.Store) cid.Cid {
+	arr, err := adt.MakeEmptyArray(store, 5)
+	require.NoError(b, err)
+	v := abi.NewTokenAmount(1)
+	for j := uint64(0); j < 1000; j++ {
+		require.NoError(b, arr.Set(j, &v))
+	}
+	r, err := arr.Root()
+	require.NoError(b, err)
+	return r
+}
+
+// Length counts populated entries, not the span of indices, so it serves as the count of a sparse array.
+func TestArrayLengthCountsPopulatedEntries(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 200; i++ {
+		require.NoError(t, arr.Set(i, &v))
+	}
+	// Delete every third entry, and a contiguous block, leaving holes throughout.
+	for i := uint64(0); i < 200; i += 3 {
+		require.NoError(t, arr.Delete(i))
+	}
+	_, err = arr.DeleteRange(100, 150)
+	require.NoError(t, err)
+
+	visited := uint64(0)
+	require.NoError(t, arr.ForEach(nil, func(i int64) error {
+		visited++
+		return nil
+	}))
+	assert.Equal(t, visited, arr.Length())
+	assert.Equal(t, uint64(99), arr.Length())
+
+	// The highest index is still populated, so the count is well below the logical length.
+	found, err := arr.Get(199, nil)
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestArrayIndices(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 2)
+	require.NoError(t, err)
+
+	indices, err := arr.Indices()
+	require.NoError(t, err)
+	assert.Empty(t, indices)
+
+	// Set out of order, spanning many levels of a narrow tree.
+	expected := []uint64{0, 1, 17, 300, 4096, 1 << 30, 1 << 45}
+	v := abi.NewTokenAmount(1)
+	for _, j := range []int{4, 0, 6, 2, 1, 5, 3} {
+		require.NoError(t, arr.Set(expected[j], &v))
+	}
+
+	// Reload so the indices come from stored nodes.
+	arr, err = adt.AsArray(store, tutil.MustRoot(t, arr), 2)
+	require.NoError(t, err)
+	indices, err = arr.Indices()
+	require.NoError(t, err)
+	assert.Equal(t, expected, indices)
+}
+
+func TestArrayCopy(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 20; i++ {
+		require.NoError(t, arr.Set(i, &v))
+	}
+	// An unflushed change is included in the copy.
+	require.NoError(t, arr.Set(100, &v))
+	original := tutil.MustRoot(t, arr)
+
+	cp, err := arr.Copy()
+	require.NoError(t, err)
+	assert.Equal(t, original, tutil.MustRoot(t, cp))
+
+	// Mutating the copy doesn't alter the original.
+	w := abi.NewTokenAmount(2)
+	require.NoError(t, cp.Set(5, &w))
+	require.NoError(t, cp.Delete(100))
+	assert.Equal(t, original, tutil.MustRoot(t, arr))
+	assert.NotEqual(t, original, tutil.MustRoot(t, cp))
+	var out abi.TokenAmount
+	found, err := arr.Get(5, &out)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, v, out)
+	assert.Equal(t, uint64(21), arr.Length())
+	assert.Equal(t, uint64(20), cp.Length())
+
+	// Nor the reverse.
+	cpRoot := tutil.MustRoot(t, cp)
+	require.NoError(t, arr.Set(6, &w))
+	assert.Equal(t, cpRoot, tutil.MustRoot(t, cp))
+}
+
+func TestArrayGetOrDefault(t *testing.T) {
+	store := adt.NewMemStore()
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(5)
+	require.NoError(t, arr.Set(3, &v))
+	def := abi.NewTokenAmount(-1)
+
+	var out abi.TokenAmount
+	require.NoError(t, arr.GetOrDefault(3, &out, &def))
+	assert.Equal(t, abi.NewTokenAmount(5), out)
+
+	for _, i := range []uint64{0, 4, 1000} {
+		out := abi.NewTokenAmount(100)
+		require.NoError(t, arr.GetOrDefault(i, &out, &def))
+		assert.Equal(t, abi.NewTokenAmount(-1), out)
+	}
+	assert.Equal(t, uint64(1), arr.Length())
+}
+
+func TestArrayMapValues(t *testing.T) {
+	store := adt.NewMemStore()
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	expected, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	// A sparse array, whose gaps must be preserved.
+	for _, i := range []uint64{0, 1, 5, 64, 1000} {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, arr.Set(i, &v))
+		// Values are migrated from token amounts to plain integers, offset by their index.
+		w := cbg.CborInt(2 * i)
+		require.NoError(t, expected.Set(i, &w))
+	}
+	original := tutil.MustRoot(t, arr)
+
+	upgraded, err := arr.MapValues(func(i uint64, raw []byte) (cbor.Marshaler, error) {
+		var v abi.TokenAmount
+		if err := v.UnmarshalCBOR(bytes.NewReader(raw)); err != nil {
+			return nil, err
+		}
+		w := cbg.CborInt(v.Int64() + int64(i))
+		return &w, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, upgraded))
+	assert.Equal(t, arr.Length(), upgraded.Length())
+	assert.Equal(t, original, tutil.MustRoot(t, arr))
+
+	failure := xerrors.New("failure")
+	_, err = arr.MapValues(func(uint64, []byte) (cbor.Marshaler, error) { return nil, failure })
+	assert.True(t, xerrors.Is(err, failure))
+}
+
+func TestArrayCompact(t *testing.T) {
+	store := adt.NewMemStore()
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	for _, i := range []uint64{0, 2, 3, 7, 20, 100} {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, arr.Set(i, &v))
+	}
+	original := tutil.MustRoot(t, arr)
+
+	// Returns the values of an array in index order, checking that its indices are contiguous.
+	values := func(a *adt.Array) []int64 {
+		var out []int64
+		var v abi.TokenAmount
+		require.NoError(t, a.ForEach(&v, func(i int64) error {
+			require.Equal(t, int64(len(out)), i)
+			out = append(out, v.Int64())
+			return nil
+		}))
+		return out
+	}
+
+	t.Run("with gaps", func(t *testing.T) {
+		var v abi.TokenAmount
+		compacted, oldIndices, err := arr.Compact(&v, func(i uint64) bool { return v.Int64() != 3 && i != 20 })
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{0, 2, 7, 100}, oldIndices)
+		assert.Equal(t, []int64{0, 2, 7, 100}, values(compacted))
+		assert.Equal(t, original, tutil.MustRoot(t, arr))
+	})
+
+	t.Run("all kept", func(t *testing.T) {
+		compacted, oldIndices, err := arr.Compact(nil, func(uint64) bool { return true })
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{0, 2, 3, 7, 20, 100}, oldIndices)
+		assert.Equal(t, []int64{0, 2, 3, 7, 20, 100}, values(compacted))
+		assert.Equal(t, arr.Length(), compacted.Length())
+	})
+
+	t.Run("all dropped", func(t *testing.T) {
+		compacted, oldIndices, err := arr.Compact(nil, func(uint64) bool { return false })
+		require.NoError(t, err)
+		assert.Empty(t, oldIndices)
+		assert.Equal(t, uint64(0), compacted.Length())
+	})
+}
+
+func TestArraySwap(t *testing.T) {
+	store := adt.NewMemStore()
+	newArray := func() *adt.Array {
+		arr, err := adt.MakeEmptyArray(store, 3)
+		require.NoError(t, err)
+		for _, i := range []uint64{1, 2, 50} {
+			v := abi.NewTokenAmount(int64(i))
+			require.NoError(t, arr.Set(i, &v))
+		}
+		return arr
+	}
+	// Returns the value at each populated index.
+	contents := func(arr *adt.Array) map[uint64]int64 {
+		out := map[uint64]int64{}
+		var v abi.TokenAmount
+		require.NoError(t, arr.ForEach(&v, func(i int64) error {
+			out[uint64(i)] = v.Int64()
+			return nil
+		}))
+		return out
+	}
+
+	t.Run("set and set", func(t *testing.T) {
+		arr := newArray()
+		require.NoError(t, arr.Swap(2, 50))
+		assert.Equal(t, map[uint64]int64{1: 1, 2: 50, 50: 2}, contents(arr))
+	})
+
+	t.Run("set and unset", func(t *testing.T) {
+		arr := newArray()
+		require.NoError(t, arr.Swap(1, 1000))
+		assert.Equal(t, map[uint64]int64{2: 2, 50: 50, 1000: 1}, contents(arr))
+
+		require.NoError(t, arr.Swap(7, 2))
+		assert.Equal(t, map[uint64]int64{7: 2, 50: 50, 1000: 1}, contents(arr))
+		assert.Equal(t, uint64(3), arr.Length())
+	})
+
+	t.Run("identical or unset indices", func(t *testing.T) {
+		arr := newArray()
+		before := tutil.MustRoot(t, arr)
+		require.NoError(t, arr.Swap(2, 2))
+		require.NoError(t, arr.Swap(3, 3))
+		require.NoError(t, arr.Swap(3, 4))
+		assert.Equal(t, before, tutil.MustRoot(t, arr))
+	})
+}
+
+func TestArrayForEachBatchesReads(t *testing.T) {
+	mem := adt.NewMemStore()
+	arr, err := adt.MakeEmptyArray(mem, 2)
+	require.NoError(t, err)
+	// Sparse indices spanning several heights of the tree.
+	var indices []uint64
+	for i := uint64(0); i < 10000; i += 37 {
+		indices = append(indices, i)
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, arr.Set(i, &v))
+	}
+	root := tutil.MustRoot(t, arr)
+	collect := func(arr *adt.Array) []uint64 {
+		var found []uint64
+		var v abi.TokenAmount
+		require.NoError(t, arr.ForEach(&v, func(i int64) error {
+			require.Equal(t, i, v.Int64())
+			found = append(found, uint64(i))
+			return nil
+		}))
+		return found
+	}
+
+	store := &batchCountingStore{Store: plainStore{mem}}
+	loaded, err := adt.AsArray(store, root, 2)
+	require.NoError(t, err)
+	assert.Equal(t, indices, collect(loaded))
+	assert.Greater(t, store.batches, 0)
+
+	// Iteration halts on error.
+	stop := xerrors.New("stop")
+	count := 0
+	err = loaded.ForEach(nil, func(i int64) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 3, count)
+
+	// An array with pending changes is traversed in memory.
+	store.batches = 0
+	v := abi.NewTokenAmount(20000)
+	require.NoError(t, loaded.Set(20000, &v))
+	assert.Equal(t, append(indices, 20000), collect(loaded))
+	assert.Equal(t, 0, store.batches)
+
+	// Once flushed, batching resumes.
+	tutil.MustRoot(t, loaded)
+	assert.Equal(t, append(indices, 20000), collect(loaded))
+	assert.Greater(t, store.batches, 0)
+}
+
+// The prefetching traversal decodes AMT nodes itself, since the AMT library doesn't export its node format.
+// This checks that it visits exactly the entries the library does, across bitwidths and heights.
+func TestArrayForEachPrefetchedMatchesAMT(t *testing.T) {
+	ctx := context.Background()
+	indexSets := map[string]func(width uint64) []uint64{
+		"empty":  func(width uint64) []uint64 { return nil },
+		"single": func(width uint64) []uint64 { return []uint64{0} },
+		"dense": func(width uint64) []uint64 {
+			var indices []uint64
+			for i := uint64(0); i < 2*width+1; i++ {
+				indices = append(indices, i)
+			}
+			return indices
+		},
+		"sparse": func(width uint64) []uint64 {
+			var indices []uint64
+			for i := uint64(1); i < width*width*width; i += width*width/2 + 1 {
+				indices = append(indices, i)
+			}
+			return indices
+		},
+		// The largest index keeps the tree short of a level spanning the whole index space, where the library's
+		// own node size arithmetic saturates.
+		"tall": func(width uint64) []uint64 {
+			return []uint64{0, width - 1, width, 1 << 40, 1<<62 - 1, 1 << 62}
+		},
+	}
+
+	for bitwidth := uint(1); bitwidth <= 8; bitwidth++ {
+		for name, indices := range indexSets {
+			t.Run(fmt.Sprintf("bitwidth %d %s", bitwidth, name), func(t *testing.T) {
+				mem := adt.NewMemStore()
+				arr, err := adt.MakeEmptyArray(mem, int(bitwidth))
+				require.NoError(t, err)
+				for _, i := range indices(uint64(1) << bitwidth) {
+					// Values of varying size.
+					v := cbg.CborCid(tutil.MakeCID(fmt.Sprint(i), nil))
+					n := cbg.CborInt(i)
+					if i%2 == 0 {
+						require.NoError(t, arr.Set(i, &v))
+					} else {
+						require.NoError(t, arr.Set(i, &n))
+					}
+				}
+				root := tutil.MustRoot(t, arr)
+
+				type entry struct {
+					i   uint64
+					raw []byte
+				}
+				var expected []entry
+				reference, err := amt.LoadAMT(ctx, mem, root, amt.UseTreeBitWidth(bitwidth))
+				require.NoError(t, err)
+				require.NoError(t, reference.ForEach(ctx, func(i uint64, val *cbg.Deferred) error {
+					expected = append(expected, entry{i, val.Raw})
+					return nil
+				}))
+
+				store := &batchCountingStore{Store: plainStore{mem}}
+				loaded, err := adt.AsArray(store, root, int(bitwidth))
+				require.NoError(t, err)
+				var actual []entry
+				var val cbg.Deferred
+				require.NoError(t, loaded.ForEach(&val, func(i int64) error {
+					actual = append(actual, entry{uint64(i), val.Raw})
+					return nil
+				}))
+				require.Equal(t, expected, actual, "prefetched traversal disagrees with the AMT library")
+				if len(expected) > 1 {
+					require.Greater(t, store.batches, 0, "prefetched traversal wasn't taken")
+				}
+			})
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package adt
 
 import (
+	"sort"
+
 	addr "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
@@ -12,6 +14,9 @@ import (
 // patterns and projections of mainnet data
 const BalanceTableBitwidth = 6
 
+// Returned (wrapped) when a balance is too small for a requested debit.
+var ErrInsufficientBalance = xerrors.New("insufficient balance")
+
 // A specialization of a map of addresses to (positive) token amounts.
 // Absent keys implicitly have a balance of zero.
 type BalanceTable Map
@@ -23,10 +28,7 @@ func AsBalanceTable(s Store, r cid.Cid) (*BalanceTable, error) {
 		return nil, err
 	}
 
-	return &BalanceTable{
-		root:  m.root,
-		store: s,
-	}, nil
+	return (*BalanceTable)(m), nil
 }
 
 // Returns the root cid of underlying HAMT.
@@ -52,15 +54,75 @@ func (t *BalanceTable) Add(key addr.Address, value abi.TokenAmount) error {
 		return err
 	}
 	sum := big.Add(prev, value)
-	sign := sum.Sign()
-	if sign < 0 {
+	if sum.Sign() < 0 {
 		return xerrors.Errorf("adding %v to balance %v would give negative: %v", value, prev, sum)
-	} else if sign == 0 && !prev.IsZero() {
+	}
+	return t.replace(key, prev, sum)
+}
+
+// Adds many amounts to balances at once, requiring every resulting balance to be non-negative.
+// If any would be negative, returns an error and leaves all balances unchanged.
+// Changes are held in memory until the next call to Root, so a batch is flushed just once.
+// Balances are updated in ascending order of address key.
+func (t *BalanceTable) AddMany(credits map[addr.Address]abi.TokenAmount) error {
+	keys := make([]addr.Address, 0, len(credits))
+	for key := range credits { //nolint:nomaprange
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return abi.AddrKey(keys[i]).Key() < abi.AddrKey(keys[j]).Key() })
+
+	prevs := make([]abi.TokenAmount, len(keys))
+	sums := make([]abi.TokenAmount, len(keys))
+	for i, key := range keys {
+		prev, err := t.Get(key)
+		if err != nil {
+			return err
+		}
+		sum := big.Add(prev, credits[key])
+		if sum.Sign() < 0 {
+			return xerrors.Errorf("adding %v to balance %v of %v would give negative: %v", credits[key], prev, key, sum)
+		}
+		prevs[i], sums[i] = prev, sum
+	}
+	for i, key := range keys {
+		if err := t.replace(key, prevs[i], sums[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces a balance of `prev` with a non-negative `sum`, removing the entry if it becomes zero.
+func (t *BalanceTable) replace(key addr.Address, prev, sum abi.TokenAmount) error {
+	if sum.IsZero() && !prev.IsZero() {
 		return (*Map)(t).Delete(abi.AddrKey(key))
 	}
 	return (*Map)(t).Put(abi.AddrKey(key), &sum)
 }
 
+// Moves a non-negative amount from one balance to another.
+// If the source balance is insufficient, returns an error wrapping ErrInsufficientBalance
+// and leaves both balances unchanged.
+func (t *BalanceTable) Transfer(from, to addr.Address, amount abi.TokenAmount) error {
+	if amount.Sign() < 0 {
+		return xerrors.Errorf("negative transfer amount %v from %v to %v", amount, from, to)
+	}
+	prev, err := t.Get(from)
+	if err != nil {
+		return err
+	}
+	if amount.GreaterThan(prev) {
+		return xerrors.Errorf("transfer of %v from %v to %v exceeds balance %v: %w", amount, from, to, prev, ErrInsufficientBalance)
+	}
+	if from == to {
+		return nil
+	}
+	if err := t.Add(from, amount.Neg()); err != nil {
+		return err
+	}
+	return t.Add(to, amount)
+}
+
 // Subtracts up to the specified amount from a balance, without reducing the balance below some minimum.
 // Returns the amount subtracted.
 func (t *BalanceTable) SubtractWithMinimum(key addr.Address, req abi.TokenAmount, floor abi.TokenAmount) (abi.TokenAmount, error) {
@@ -81,19 +143,21 @@ func (t *BalanceTable) SubtractWithMinimum(key addr.Address, req abi.TokenAmount
 }
 
 // MustSubtract subtracts the given amount from the account's balance.
-// Returns an error if the account has insufficient balance
+// Returns an error wrapping ErrInsufficientBalance, and leaves the balance unchanged,
+// if the account has insufficient balance.
 func (t *BalanceTable) MustSubtract(key addr.Address, req abi.TokenAmount) error {
 	prev, err := t.Get(key)
 	if err != nil {
 		return err
 	}
 	if req.GreaterThan(prev) {
-		return xerrors.New("couldn't subtract the requested amount")
+		return xerrors.Errorf("couldn't subtract %v from balance %v of %v: %w", req, prev, key, ErrInsufficientBalance)
 	}
 	return t.Add(key, req.Neg())
 }
 
-// Returns the total balance held by this BalanceTable
+// Returns the total balance held by this BalanceTable, which is zero for an empty table.
+// This traverses the whole table, e.g. to reconcile it against an actor's recorded balance.
 func (t *BalanceTable) Total() (abi.TokenAmount, error) {
 	total := big.Zero()
 	var cur abi.TokenAmount
@@ -101,5 +165,51 @@ func (t *BalanceTable) Total() (abi.TokenAmount, error) {
 		total = big.Add(total, cur)
 		return nil
 	})
-	return total, err
+	if err != nil {
+		return big.Zero(), xerrors.Errorf("failed to sum balances: %w", err)
+	}
+	return total, nil
+}
+
+// Iterates all balances in the table, calling a function with each address and its balance.
+// Iteration halts if the function returns an error, and stops without error if it returns StopIteration.
+func (t *BalanceTable) ForEach(fn func(key addr.Address, balance abi.TokenAmount) error) error {
+	var cur abi.TokenAmount
+	return (*Map)(t).ForEach(&cur, func(k string) error {
+		a, err := ParseAddrKey(k)
+		if err != nil {
+			return xerrors.Errorf("failed to parse address key %x: %w", k, err)
+		}
+		return fn(a, cur)
+	})
+}
+
+// Computes the change in each balance from this table to `other`, keyed by address.
+// A delta is positive where `other` holds the larger balance. Addresses absent from one table are treated as
+// having a zero balance there, and addresses with equal balances in both tables are omitted.
+func (t *BalanceTable) Diff(other *BalanceTable) (map[addr.Address]abi.TokenAmount, error) {
+	deltas := make(map[addr.Address]abi.TokenAmount)
+	if err := t.ForEach(func(key addr.Address, balance abi.TokenAmount) error {
+		if !balance.IsZero() {
+			deltas[key] = balance.Neg()
+		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to iterate balances: %w", err)
+	}
+	if err := other.ForEach(func(key addr.Address, balance abi.TokenAmount) error {
+		prev, ok := deltas[key]
+		if !ok {
+			prev = big.Zero()
+		}
+		if delta := big.Add(prev, balance); delta.IsZero() {
+			delete(deltas, key)
+		} else {
+			deltas[key] = delta
+		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to iterate other balances: %w", err)
+	}
+	return deltas, nil
 }
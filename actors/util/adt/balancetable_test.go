@@ -1,6 +1,7 @@
 package adt_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/filecoin-project/go-address"
@@ -8,9 +9,11 @@ import (
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
 	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
 	"github.com/filecoin-project/specs-actors/v5/support/mock"
 	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
 )
@@ -71,8 +74,12 @@ func TestBalanceTable(t *testing.T) {
 
 		require.NoError(t, bt.Add(addr, abi.NewTokenAmount(5)))
 
-		// Fail to subtract more than available
-		require.Error(t, bt.MustSubtract(addr, abi.NewTokenAmount(6)))
+		// Fail to subtract more than available, leaving the table unchanged
+		root := tutil.MustRoot(t, bt)
+		err := bt.MustSubtract(addr, abi.NewTokenAmount(6))
+		require.Error(t, err)
+		assert.True(t, xerrors.Is(err, adt.ErrInsufficientBalance))
+		assert.Equal(t, root, tutil.MustRoot(t, bt))
 		bal, err := bt.Get(addr)
 		require.NoError(t, err)
 		require.Equal(t, abi.NewTokenAmount(5), bal)
@@ -94,6 +101,52 @@ func TestBalanceTable(t *testing.T) {
 		require.False(t, found)
 	})
 
+	t.Run("Transfer moves balance between accounts", func(t *testing.T) {
+		from := tutil.NewIDAddr(t, 100)
+		to := tutil.NewIDAddr(t, 101)
+		bt := buildBalanceTable()
+		require.NoError(t, bt.Add(from, abi.NewTokenAmount(10)))
+		require.NoError(t, bt.Add(to, abi.NewTokenAmount(1)))
+
+		require.NoError(t, bt.Transfer(from, to, abi.NewTokenAmount(4)))
+		bal, err := bt.Get(from)
+		require.NoError(t, err)
+		assert.Equal(t, abi.NewTokenAmount(6), bal)
+		bal, err = bt.Get(to)
+		require.NoError(t, err)
+		assert.Equal(t, abi.NewTokenAmount(5), bal)
+
+		// Insufficient funds leave the table untouched.
+		root := tutil.MustRoot(t, bt)
+		err = bt.Transfer(from, to, abi.NewTokenAmount(7))
+		require.Error(t, err)
+		assert.True(t, xerrors.Is(err, adt.ErrInsufficientBalance))
+		assert.Equal(t, root, tutil.MustRoot(t, bt))
+		err = bt.Transfer(tutil.NewIDAddr(t, 102), to, abi.NewTokenAmount(1))
+		assert.True(t, xerrors.Is(err, adt.ErrInsufficientBalance))
+		assert.Equal(t, root, tutil.MustRoot(t, bt))
+
+		// Negative amounts are rejected.
+		require.Error(t, bt.Transfer(from, to, abi.NewTokenAmount(-1)))
+		assert.Equal(t, root, tutil.MustRoot(t, bt))
+
+		// Transferring the whole balance removes the source entry.
+		require.NoError(t, bt.Transfer(from, to, abi.NewTokenAmount(6)))
+		found, err := ((*adt.Map)(bt)).Get(abi.AddrKey(from), nil)
+		require.NoError(t, err)
+		require.False(t, found)
+		bal, err = bt.Get(to)
+		require.NoError(t, err)
+		assert.Equal(t, abi.NewTokenAmount(11), bal)
+
+		// Transfer to self only checks the balance.
+		require.NoError(t, bt.Transfer(to, to, abi.NewTokenAmount(11)))
+		require.Error(t, bt.Transfer(to, to, abi.NewTokenAmount(12)))
+		bal, err = bt.Get(to)
+		require.NoError(t, err)
+		assert.Equal(t, abi.NewTokenAmount(11), bal)
+	})
+
 	t.Run("Total returns total amount tracked", func(t *testing.T) {
 		addr1 := tutil.NewIDAddr(t, 100)
 		addr2 := tutil.NewIDAddr(t, 101)
@@ -123,6 +176,203 @@ func TestBalanceTable(t *testing.T) {
 			assert.Equal(t, abi.NewTokenAmount(tc.total), total)
 		}
 	})
+
+	t.Run("ForEach visits addresses and balances", func(t *testing.T) {
+		bt := buildBalanceTable()
+		expected := map[address.Address]abi.TokenAmount{
+			tutil.NewIDAddr(t, 100):          abi.NewTokenAmount(1),
+			tutil.NewIDAddr(t, 1<<40):        abi.NewTokenAmount(2),
+			tutil.NewSECP256K1Addr(t, "key"): abi.NewTokenAmount(3),
+			tutil.NewBLSAddr(t, 1):           abi.NewTokenAmount(4),
+			tutil.NewActorAddr(t, "actor"):   abi.NewTokenAmount(5),
+		}
+		for a, amount := range expected {
+			require.NoError(t, bt.Add(a, amount))
+		}
+
+		visited := map[address.Address]abi.TokenAmount{}
+		require.NoError(t, bt.ForEach(func(a address.Address, balance abi.TokenAmount) error {
+			visited[a] = balance
+			return nil
+		}))
+		assert.Equal(t, expected, visited)
+
+		count := 0
+		require.NoError(t, bt.ForEach(func(a address.Address, balance abi.TokenAmount) error {
+			count++
+			if count == 2 {
+				return adt.StopIteration
+			}
+			return nil
+		}))
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("Total sums a large table", func(t *testing.T) {
+		bt := buildBalanceTable()
+		expected := big.Zero()
+		for i := uint64(0); i < 500; i++ {
+			amount := abi.NewTokenAmount(int64(i * 1000))
+			require.NoError(t, bt.Add(tutil.NewIDAddr(t, 100+i), amount))
+			expected = big.Add(expected, amount)
+		}
+		// Emptied balances don't contribute.
+		require.NoError(t, bt.MustSubtract(tutil.NewIDAddr(t, 101), abi.NewTokenAmount(1000)))
+		expected = big.Sub(expected, abi.NewTokenAmount(1000))
+
+		total, err := bt.Total()
+		require.NoError(t, err)
+		assert.Equal(t, expected, total)
+	})
+}
+
+func TestBalanceTableAddMany(t *testing.T) {
+	newTable := func(store adt.Store) *adt.BalanceTable {
+		emptyMap, err := adt.MakeEmptyMap(store, adt.BalanceTableBitwidth)
+		require.NoError(t, err)
+		bt, err := adt.AsBalanceTable(store, tutil.MustRoot(t, emptyMap))
+		require.NoError(t, err)
+		return bt
+	}
+	addr1 := tutil.NewIDAddr(t, 100)
+	addr2 := tutil.NewIDAddr(t, 101)
+	addr3 := tutil.NewIDAddr(t, 102)
+
+	t.Run("creates and sums balances", func(t *testing.T) {
+		bt := newTable(adt.NewMemStore())
+		require.NoError(t, bt.Add(addr1, abi.NewTokenAmount(10)))
+		require.NoError(t, bt.Add(addr2, abi.NewTokenAmount(5)))
+
+		require.NoError(t, bt.AddMany(map[address.Address]abi.TokenAmount{
+			addr1: abi.NewTokenAmount(3),
+			addr2: abi.NewTokenAmount(-5),
+			addr3: abi.NewTokenAmount(7),
+		}))
+		for a, expected := range map[address.Address]int64{addr1: 13, addr2: 0, addr3: 7} {
+			balance, err := bt.Get(a)
+			require.NoError(t, err)
+			assert.Equal(t, expected, balance.Int64())
+		}
+		count, err := (*adt.Map)(bt).Count()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), count)
+	})
+
+	t.Run("matches per-account adds", func(t *testing.T) {
+		store := adt.NewMemStore()
+		looped := newTable(store)
+		batched := newTable(store)
+		credits := map[address.Address]abi.TokenAmount{}
+		for i := uint64(0); i < 200; i++ {
+			a := tutil.NewIDAddr(t, 1000+i)
+			credits[a] = abi.NewTokenAmount(int64(i + 1))
+			require.NoError(t, looped.Add(a, credits[a]))
+		}
+		require.NoError(t, batched.AddMany(credits))
+		assert.Equal(t, tutil.MustRoot(t, looped), tutil.MustRoot(t, batched))
+	})
+
+	t.Run("negative result leaves balances unchanged", func(t *testing.T) {
+		bt := newTable(adt.NewMemStore())
+		require.NoError(t, bt.Add(addr1, abi.NewTokenAmount(10)))
+		before := tutil.MustRoot(t, bt)
+
+		err := bt.AddMany(map[address.Address]abi.TokenAmount{
+			addr1: abi.NewTokenAmount(5),
+			addr2: abi.NewTokenAmount(-1),
+		})
+		require.Error(t, err)
+		assert.Equal(t, before, tutil.MustRoot(t, bt))
+	})
+}
+
+func TestBalanceTableDiff(t *testing.T) {
+	store := adt.NewMemStore()
+	newTable := func(balances map[uint64]int64) *adt.BalanceTable {
+		root, err := adt.StoreEmptyMap(store, adt.BalanceTableBitwidth)
+		require.NoError(t, err)
+		bt, err := adt.AsBalanceTable(store, root)
+		require.NoError(t, err)
+		for id, amount := range balances {
+			require.NoError(t, bt.Add(tutil.NewIDAddr(t, id), abi.NewTokenAmount(amount)))
+		}
+		return bt
+	}
+
+	before := newTable(map[uint64]int64{100: 10, 101: 20, 102: 30})
+	after := newTable(map[uint64]int64{100: 10, 101: 25, 102: 0, 103: 7})
+
+	deltas, err := before.Diff(after)
+	require.NoError(t, err)
+	assert.Equal(t, map[address.Address]int64{
+		tutil.NewIDAddr(t, 101): 5,
+		tutil.NewIDAddr(t, 102): -30,
+		tutil.NewIDAddr(t, 103): 7,
+	}, int64Balances(deltas))
+
+	// The reverse diff negates every delta.
+	reverse, err := after.Diff(before)
+	require.NoError(t, err)
+	assert.Equal(t, map[address.Address]int64{
+		tutil.NewIDAddr(t, 101): -5,
+		tutil.NewIDAddr(t, 102): 30,
+		tutil.NewIDAddr(t, 103): -7,
+	}, int64Balances(reverse))
+
+	// Identical tables have no deltas.
+	same, err := before.Diff(before)
+	require.NoError(t, err)
+	assert.Empty(t, same)
+}
+
+func int64Balances(balances map[address.Address]abi.TokenAmount) map[address.Address]int64 {
+	out := make(map[address.Address]int64, len(balances))
+	for a, amount := range balances {
+		out[a] = amount.Int64()
+	}
+	return out
+}
+
+func benchmarkCredits(b *testing.B) map[address.Address]abi.TokenAmount {
+	credits := make(map[address.Address]abi.TokenAmount, 1000)
+	for i := uint64(0); i < 1000; i++ {
+		credits[tutil.NewIDAddr(b, 1000+i)] = abi.NewTokenAmount(int64(i + 1))
+	}
+	return credits
+}
+
+func BenchmarkBalanceTableAddFlushEach(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	credits := benchmarkCredits(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root, err := adt.StoreEmptyMap(store, adt.BalanceTableBitwidth)
+		require.NoError(b, err)
+		for a, amount := range credits {
+			bt, err := adt.AsBalanceTable(store, root)
+			require.NoError(b, err)
+			require.NoError(b, bt.Add(a, amount))
+			root, err = bt.Root()
+			require.NoError(b, err)
+		}
+	}
+}
+
+func BenchmarkBalanceTableAddMany(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	credits := benchmarkCredits(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root, err := adt.StoreEmptyMap(store, adt.BalanceTableBitwidth)
+		require.NoError(b, err)
+		bt, err := adt.AsBalanceTable(store, root)
+		require.NoError(b, err)
+		require.NoError(b, bt.AddMany(credits))
+		_, err = bt.Root()
+		require.NoError(b, err)
+	}
 }
 
 func TestSubtractWithMinimum(t *testing.T) {
@@ -171,4 +421,42 @@ func TestSubtractWithMinimum(t *testing.T) {
 		require.NoError(t, err)
 		require.EqualValues(t, abi.NewTokenAmount(2), remaining)
 	})
+
+	t.Run("request smaller than available excess", func(t *testing.T) {
+		bt := buildBalanceTable()
+		require.NoError(t, bt.Add(addr, abi.NewTokenAmount(10)))
+
+		s, err := bt.SubtractWithMinimum(addr, abi.NewTokenAmount(3), abi.NewTokenAmount(2))
+		require.NoError(t, err)
+		require.EqualValues(t, abi.NewTokenAmount(3), s)
+
+		remaining, err := bt.Get(addr)
+		require.NoError(t, err)
+		require.EqualValues(t, abi.NewTokenAmount(7), remaining)
+	})
+
+	t.Run("balance below floor is left untouched", func(t *testing.T) {
+		bt := buildBalanceTable()
+		require.NoError(t, bt.Add(addr, abi.NewTokenAmount(3)))
+		root := tutil.MustRoot(t, bt)
+
+		s, err := bt.SubtractWithMinimum(addr, abi.NewTokenAmount(3), abi.NewTokenAmount(4))
+		require.NoError(t, err)
+		require.EqualValues(t, zeroAmt, s)
+		assert.Equal(t, root, tutil.MustRoot(t, bt))
+	})
+
+	t.Run("floor of zero withdraws whole balance", func(t *testing.T) {
+		bt := buildBalanceTable()
+		require.NoError(t, bt.Add(addr, abi.NewTokenAmount(3)))
+
+		s, err := bt.SubtractWithMinimum(addr, abi.NewTokenAmount(100), zeroAmt)
+		require.NoError(t, err)
+		require.EqualValues(t, abi.NewTokenAmount(3), s)
+
+		// The zero entry is not stored.
+		found, err := ((*adt.Map)(bt)).Get(abi.AddrKey(addr), nil)
+		require.NoError(t, err)
+		require.False(t, found)
+	})
 }
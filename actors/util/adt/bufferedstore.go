@@ -0,0 +1,107 @@
+package adt
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/cbor"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// BufferedStore is a Store that holds written blocks in memory until they are explicitly flushed to an
+// underlying store, or discarded. Reads see buffered blocks before those in the underlying store.
+// Blocks are addressed with abi.CidBuilder, which must match the addressing of the underlying store.
+// A BufferedStore is not safe for concurrent use.
+type BufferedStore struct {
+	underlying Store
+	blocks     map[cid.Cid][]byte
+	order      []cid.Cid // Buffered CIDs in order of first write, so flushes are deterministic.
+}
+
+var _ HasStore = (*BufferedStore)(nil)
+
+// Creates a new store buffering writes to `underlying`.
+func NewBufferedStore(underlying Store) *BufferedStore {
+	return &BufferedStore{
+		underlying: underlying,
+		blocks:     make(map[cid.Cid][]byte),
+	}
+}
+
+func (s *BufferedStore) Context() context.Context {
+	return s.underlying.Context()
+}
+
+func (s *BufferedStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	data, found := s.blocks[c]
+	if !found {
+		return s.underlying.Get(ctx, c, out)
+	}
+	um, ok := out.(cbor.Unmarshaler)
+	if !ok {
+		return xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", c, out)
+	}
+	return um.UnmarshalCBOR(bytes.NewReader(data))
+}
+
+// Has checks for a block in the buffer, and then in the underlying store.
+func (s *BufferedStore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if _, found := s.blocks[c]; found {
+		return true, nil
+	}
+	return Has(ctx, s.underlying, c)
+}
+
+// Put serializes `v`, which must be a cbor.Marshaler, and buffers the block, returning its CID.
+func (s *BufferedStore) Put(_ context.Context, v interface{}) (cid.Cid, error) {
+	m, ok := v.(cbor.Marshaler)
+	if !ok {
+		return cid.Undef, xerrors.Errorf("can't marshal %T, which is not a cbor.Marshaler", v)
+	}
+	var buf bytes.Buffer
+	if err := m.MarshalCBOR(&buf); err != nil {
+		return cid.Undef, xerrors.Errorf("failed to marshal %T: %w", v, err)
+	}
+	c, err := abi.CidBuilder.Sum(buf.Bytes())
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("failed to compute cid: %w", err)
+	}
+	if _, found := s.blocks[c]; !found {
+		s.blocks[c] = buf.Bytes()
+		s.order = append(s.order, c)
+	}
+	return c, nil
+}
+
+// Writes all buffered blocks to the underlying store, in the order they were first written, and clears the buffer.
+// If writing fails, the blocks not yet written remain buffered.
+func (s *BufferedStore) Flush() error {
+	for len(s.order) > 0 {
+		c := s.order[0]
+		written, err := s.underlying.Put(s.Context(), &cbg.Deferred{Raw: s.blocks[c]})
+		if err != nil {
+			return xerrors.Errorf("failed to flush block %v: %w", c, err)
+		}
+		if !written.Equals(c) {
+			return xerrors.Errorf("underlying store addressed block %v as %v", c, written)
+		}
+		delete(s.blocks, c)
+		s.order = s.order[1:]
+	}
+	s.order = nil
+	return nil
+}
+
+// Discards all buffered blocks.
+func (s *BufferedStore) Abort() {
+	s.blocks = make(map[cid.Cid][]byte)
+	s.order = nil
+}
+
+// Returns the number of blocks buffered.
+func (s *BufferedStore) Len() int {
+	return len(s.order)
+}
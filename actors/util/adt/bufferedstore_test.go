@@ -0,0 +1,86 @@
+package adt_test
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestBufferedStore(t *testing.T) {
+	populate := func(store adt.Store) cid.Cid {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 100; i++ {
+			v := abi.NewTokenAmount(int64(i))
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		return tutil.MustRoot(t, m)
+	}
+
+	t.Run("reads see buffered writes", func(t *testing.T) {
+		underlying := adt.NewMemStore()
+		buffered := adt.NewBufferedStore(underlying)
+		written := populate(buffered)
+		assert.Equal(t, 0, underlying.Len())
+		assert.True(t, buffered.Len() > 0)
+
+		m, err := adt.AsMap(buffered, written, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var out abi.TokenAmount
+		found, err := m.Get(abi.UIntKey(42), &out)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, abi.NewTokenAmount(42), out)
+	})
+
+	t.Run("abort discards writes", func(t *testing.T) {
+		underlying := adt.NewMemStore()
+		buffered := adt.NewBufferedStore(underlying)
+		written := populate(buffered)
+		buffered.Abort()
+		assert.Equal(t, 0, buffered.Len())
+		assert.Equal(t, 0, underlying.Len())
+
+		// Nothing reaches the underlying store, even if flushed after aborting.
+		require.NoError(t, buffered.Flush())
+		assert.Equal(t, 0, underlying.Len())
+		_, err := adt.AsMap(underlying, written, builtin.DefaultHamtBitwidth)
+		assert.Error(t, err)
+	})
+
+	t.Run("flush writes through", func(t *testing.T) {
+		underlying := adt.NewMemStore()
+		buffered := adt.NewBufferedStore(underlying)
+		written := populate(buffered)
+		count := buffered.Len()
+		require.NoError(t, buffered.Flush())
+		assert.Equal(t, 0, buffered.Len())
+		assert.Equal(t, count, underlying.Len())
+
+		// The same map is readable directly from the underlying store.
+		m, err := adt.AsMap(underlying, written, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var out abi.TokenAmount
+		found, err := m.Get(abi.UIntKey(7), &out)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, abi.NewTokenAmount(7), out)
+
+		// Reads of flushed blocks fall through to the underlying store, and later writes build on them.
+		m, err = adt.AsMap(buffered, written, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1000)
+		require.NoError(t, m.Put(abi.UIntKey(1000), &v))
+		root := tutil.MustRoot(t, m)
+		require.NoError(t, buffered.Flush())
+		_, err = adt.AsMap(underlying, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,265 @@
+package adt
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-state-types/cbor"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Default number of blocks held by a CachingStore.
+const DefaultCachingStoreSize = 1024
+
+// CachingStore is a Store that keeps the most recently read or written blocks in memory, in serialized form,
+// so that repeated reads of the same block don't reach the underlying store.
+// Since a CID always identifies the same bytes, cached blocks never become stale, though a block deleted from
+// the underlying store other than through the CachingStore may still be read from the cache.
+// Writes are passed straight through to the underlying store.
+// It's a BatchStore or a DeleteStore exactly when the underlying store is, so collections use it just as they
+// would the underlying store. It's always a HasStore and a TryGetStore, falling back as Has and TryGet do.
+// A CachingStore is safe for concurrent use if the underlying store is.
+type CachingStore interface {
+	HasStore
+	TryGetStore
+	// Returns the number of blocks currently cached.
+	Len() int
+}
+
+type cachingStore struct {
+	underlying Store
+	size       int
+
+	mu      sync.Mutex
+	entries map[cid.Cid]*list.Element
+	lru     *list.List // Of *cachedBlock, most recently used first.
+}
+
+type cachedBlock struct {
+	c    cid.Cid
+	data []byte
+}
+
+// Creates a new store caching up to `size` blocks from `underlying`.
+// A non-positive size selects DefaultCachingStoreSize.
+func NewCachingStore(underlying Store, size int) CachingStore {
+	if size <= 0 {
+		size = DefaultCachingStoreSize
+	}
+	s := &cachingStore{
+		underlying: underlying,
+		size:       size,
+		entries:    make(map[cid.Cid]*list.Element),
+		lru:        list.New(),
+	}
+	_, batch := underlying.(BatchStore)
+	_, del := underlying.(DeleteStore)
+	switch {
+	case batch && del:
+		return cachingBatchDeleteStore{s}
+	case batch:
+		return cachingBatchStore{s}
+	case del:
+		return cachingDeleteStore{s}
+	default:
+		return s
+	}
+}
+
+func (s *cachingStore) Context() context.Context {
+	return s.underlying.Context()
+}
+
+func (s *cachingStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	um, ok := out.(cbor.Unmarshaler)
+	if !ok {
+		return xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", c, out)
+	}
+	data, found := s.lookup(c)
+	if !found {
+		var raw cbg.Deferred
+		if err := s.underlying.Get(ctx, c, &raw); err != nil {
+			return err
+		}
+		data = raw.Raw
+		s.insert(c, data)
+	}
+	return um.UnmarshalCBOR(bytes.NewReader(data))
+}
+
+// Has checks for a block in the cache, and then in the underlying store.
+func (s *cachingStore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	s.mu.Lock()
+	_, found := s.entries[c]
+	s.mu.Unlock()
+	if found {
+		return true, nil
+	}
+	return Has(ctx, s.underlying, c)
+}
+
+// TryGet deserializes a cached block, or retrieves it from the underlying store if present and caches it.
+func (s *cachingStore) TryGet(ctx context.Context, c cid.Cid, out interface{}) (bool, error) {
+	um, ok := out.(cbor.Unmarshaler)
+	if !ok {
+		return false, xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", c, out)
+	}
+	data, found := s.lookup(c)
+	if !found {
+		var raw cbg.Deferred
+		if present, err := TryGet(ctx, s.underlying, c, &raw); err != nil || !present {
+			return false, err
+		}
+		data = raw.Raw
+		s.insert(c, data)
+	}
+	return true, um.UnmarshalCBOR(bytes.NewReader(data))
+}
+
+// Deserializes many blocks at once, retrieving those not cached from the underlying store in a single batch.
+func (s *cachingStore) getMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	if len(cids) != len(out) {
+		return xerrors.Errorf("mismatched lengths of %d cids and %d outputs", len(cids), len(out))
+	}
+	blocks := make([][]byte, len(cids))
+	var missed []cid.Cid
+	var missedIdx []int
+	for i, c := range cids {
+		if data, found := s.lookup(c); found {
+			blocks[i] = data
+		} else {
+			missed = append(missed, c)
+			missedIdx = append(missedIdx, i)
+		}
+	}
+	if len(missed) > 0 {
+		raws := make([]cbg.Deferred, len(missed))
+		rawOut := make([]interface{}, len(missed))
+		for j := range raws {
+			rawOut[j] = &raws[j]
+		}
+		if err := s.underlying.(BatchStore).GetMany(ctx, missed, rawOut); err != nil {
+			return err
+		}
+		for j, c := range missed {
+			s.insert(c, raws[j].Raw)
+			blocks[missedIdx[j]] = raws[j].Raw
+		}
+	}
+
+	for i, data := range blocks {
+		um, ok := out[i].(cbor.Unmarshaler)
+		if !ok {
+			return xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", cids[i], out[i])
+		}
+		if err := um.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put serializes `v`, which must be a cbor.Marshaler, and writes the block to the underlying store,
+// caching it for subsequent reads.
+func (s *cachingStore) Put(ctx context.Context, v interface{}) (cid.Cid, error) {
+	m, ok := v.(cbor.Marshaler)
+	if !ok {
+		return cid.Undef, xerrors.Errorf("can't marshal %T, which is not a cbor.Marshaler", v)
+	}
+	var buf bytes.Buffer
+	if err := m.MarshalCBOR(&buf); err != nil {
+		return cid.Undef, xerrors.Errorf("failed to marshal %T: %w", v, err)
+	}
+	c, err := s.underlying.Put(ctx, &cbg.Deferred{Raw: buf.Bytes()})
+	if err != nil {
+		return cid.Undef, err
+	}
+	s.insert(c, buf.Bytes())
+	return c, nil
+}
+
+// Deletes a block from the underlying store, and from the cache.
+func (s *cachingStore) delete(ctx context.Context, c cid.Cid) error {
+	err := s.underlying.(DeleteStore).Delete(ctx, c)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, found := s.entries[c]; found {
+		s.lru.Remove(elem)
+		delete(s.entries, c)
+	}
+	return err
+}
+
+func (s *cachingStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *cachingStore) lookup(c cid.Cid) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, found := s.entries[c]
+	if !found {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*cachedBlock).data, true
+}
+
+func (s *cachingStore) insert(c cid.Cid, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, found := s.entries[c]; found {
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.entries[c] = s.lru.PushFront(&cachedBlock{c: c, data: data})
+	for s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cachedBlock).c)
+	}
+}
+
+// A caching store over a BatchStore.
+type cachingBatchStore struct {
+	*cachingStore
+}
+
+var _ BatchStore = cachingBatchStore{}
+
+func (s cachingBatchStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	return s.getMany(ctx, cids, out)
+}
+
+// A caching store over a DeleteStore.
+type cachingDeleteStore struct {
+	*cachingStore
+}
+
+var _ DeleteStore = cachingDeleteStore{}
+
+func (s cachingDeleteStore) Delete(ctx context.Context, c cid.Cid) error {
+	return s.delete(ctx, c)
+}
+
+// A caching store over a store that is both a BatchStore and a DeleteStore.
+type cachingBatchDeleteStore struct {
+	*cachingStore
+}
+
+var _ BatchStore = cachingBatchDeleteStore{}
+var _ DeleteStore = cachingBatchDeleteStore{}
+
+func (s cachingBatchDeleteStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	return s.getMany(ctx, cids, out)
+}
+
+func (s cachingBatchDeleteStore) Delete(ctx context.Context, c cid.Cid) error {
+	return s.delete(ctx, c)
+}
@@ -0,0 +1,169 @@
+package adt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestCachingStore(t *testing.T) {
+	ctx := context.Background()
+	bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+	store := adt.NewCachingStore(adt.WrapBlockStore(ctx, bs), 2)
+
+	var cids []cid.Cid
+	for i := int64(0); i < 3; i++ {
+		v := abi.NewTokenAmount(i)
+		c, err := store.Put(ctx, &v)
+		require.NoError(t, err)
+		cids = append(cids, c)
+	}
+	assert.Equal(t, uint64(3), bs.WriteCount())
+	// The cache is bounded.
+	assert.Equal(t, 2, store.Len())
+
+	// Recently written blocks are read from the cache.
+	var out abi.TokenAmount
+	require.NoError(t, store.Get(ctx, cids[2], &out))
+	assert.Equal(t, abi.NewTokenAmount(2), out)
+	require.NoError(t, store.Get(ctx, cids[1], &out))
+	assert.Equal(t, abi.NewTokenAmount(1), out)
+	assert.Equal(t, uint64(0), bs.ReadCount())
+
+	// The evicted block is read through, and then cached, evicting the least recently used.
+	require.NoError(t, store.Get(ctx, cids[0], &out))
+	assert.Equal(t, abi.NewTokenAmount(0), out)
+	require.NoError(t, store.Get(ctx, cids[0], &out))
+	assert.Equal(t, uint64(1), bs.ReadCount())
+	require.NoError(t, store.Get(ctx, cids[1], &out))
+	assert.Equal(t, uint64(1), bs.ReadCount())
+	require.NoError(t, store.Get(ctx, cids[2], &out))
+	assert.Equal(t, uint64(2), bs.ReadCount())
+
+	// Errors from the underlying store are returned.
+	assert.Error(t, store.Get(ctx, tutil.MakeCID("missing", nil), &out))
+	var s string
+	assert.Error(t, store.Get(ctx, cids[0], &s))
+	_, err := store.Put(ctx, "string")
+	assert.Error(t, err)
+}
+
+func TestCachingStoreCollections(t *testing.T) {
+	underlying := adt.NewMemStore()
+	store := adt.NewCachingStore(underlying, 0)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 100; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	root := tutil.MustRoot(t, m)
+
+	// The map is readable through both the caching and underlying stores.
+	for _, s := range []adt.Store{store, underlying} {
+		m, err := adt.AsMap(s, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var out abi.TokenAmount
+		found, err := m.Get(abi.UIntKey(42), &out)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, abi.NewTokenAmount(42), out)
+	}
+	_, err = adt.AsMap(store, tutil.MakeCID("missing", nil), builtin.DefaultHamtBitwidth)
+	assert.True(t, xerrors.Is(err, adt.ErrNotFound))
+}
+
+func TestCachingStoreCapabilities(t *testing.T) {
+	mem := adt.NewMemStore()
+	store := adt.NewCachingStore(mem, 0)
+	v := abi.NewTokenAmount(1)
+	c, err := store.Put(store.Context(), &v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+
+	// Optional reads hit the cache, and report a miss without an error.
+	var out abi.TokenAmount
+	found, err := store.TryGet(store.Context(), c, &out)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, v, out)
+	found, err = store.TryGet(store.Context(), tutil.MakeCID("missing", nil), &out)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// A delete is passed to the underlying store and evicts the cached block.
+	ds, ok := store.(adt.DeleteStore)
+	require.True(t, ok)
+	require.NoError(t, ds.Delete(store.Context(), c))
+	assert.Equal(t, 0, store.Len())
+	assert.Equal(t, 0, mem.Len())
+	found, err = store.TryGet(store.Context(), c, &out)
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, ok = store.(adt.BatchStore)
+	assert.True(t, ok)
+
+	// Batch reads and deletes aren't claimed over a store without them.
+	plain := adt.NewCachingStore(plainStore{mem}, 0)
+	_, ok = plain.(adt.BatchStore)
+	assert.False(t, ok)
+	_, ok = plain.(adt.DeleteStore)
+	assert.False(t, ok)
+	_, ok = adt.NewCachingStore(batchOnlyStore{plainStore{mem}}, 0).(adt.DeleteStore)
+	assert.False(t, ok)
+	_, ok = adt.NewCachingStore(deleteOnlyStore{plainStore{mem}}, 0).(adt.BatchStore)
+	assert.False(t, ok)
+}
+
+// Reports the number of reads reaching the underlying block store while iterating a map and then looking up
+// each of its keys, each time loading the map afresh from its root.
+func BenchmarkCachingStoreReads(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		name := "uncached"
+		if cached {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+			var store adt.Store = adt.WrapBlockStore(ctx, bs)
+			if cached {
+				store = adt.NewCachingStore(store, 0)
+			}
+			m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+			require.NoError(b, err)
+			v := abi.NewTokenAmount(1)
+			for j := uint64(0); j < 1000; j++ {
+				require.NoError(b, m.Put(abi.UIntKey(j), &v))
+			}
+			root, err := m.Root()
+			require.NoError(b, err)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			startReads := bs.ReadCount()
+			for i := 0; i < b.N; i++ {
+				m, err := adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+				require.NoError(b, err)
+				require.NoError(b, m.ForEach(nil, func(k string) error { return nil }))
+				for j := uint64(0); j < 1000; j++ {
+					m, err := adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+					require.NoError(b, err)
+					_, err = m.Get(abi.UIntKey(j), nil)
+					require.NoError(b, err)
+				}
+			}
+			b.ReportMetric(float64(bs.ReadCount()-startReads)/float64(b.N), "reads/op")
+		})
+	}
+}
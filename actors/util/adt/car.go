@@ -0,0 +1,214 @@
+package adt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	hamt "github.com/filecoin-project/go-hamt-ipld/v3"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Maximum size of a CAR header or block section accepted on import.
+const maxCARSectionSize = 4 << 20
+
+// Writes the map as a CARv1 archive, with the map's root as the single root, followed by every node of the HAMT.
+// Links held within values are not followed, so blocks referenced by values (such as the arrays of a
+// Multimap) are not included.
+func (m *Map) ExportCAR(w io.Writer) error {
+	root, err := m.Root()
+	if err != nil {
+		return err
+	}
+	if err := writeCARHeader(w, root); err != nil {
+		return xerrors.Errorf("failed to write car header: %w", err)
+	}
+
+	visited := map[cid.Cid]struct{}{}
+	var writeNode func(c cid.Cid) error
+	writeNode = func(c cid.Cid) error {
+		if _, ok := visited[c]; ok {
+			return nil
+		}
+		visited[c] = struct{}{}
+
+		var raw cbg.Deferred
+		if err := m.store.Get(m.store.Context(), c, &raw); err != nil {
+			return xerrors.Errorf("failed to load node %v: %w", c, err)
+		}
+		if err := writeCARSection(w, c, raw.Raw); err != nil {
+			return xerrors.Errorf("failed to write node %v: %w", c, err)
+		}
+		var node hamt.Node
+		if err := node.UnmarshalCBOR(bytes.NewReader(raw.Raw)); err != nil {
+			return xerrors.Errorf("failed to decode node %v: %w", c, err)
+		}
+		for _, p := range node.Pointers {
+			if p.Link.Defined() {
+				if err := writeNode(p.Link); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return writeNode(root)
+}
+
+// Reads a CARv1 archive, such as one written by Map.ExportCAR, into a store, returning the archive's single root.
+// Each block is verified against its CID, and must be addressed by the store with the same CID.
+func ImportMapCAR(s Store, r io.Reader) (cid.Cid, error) {
+	br := bufio.NewReader(r)
+	header, err := readCARSection(br)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("failed to read car header: %w", err)
+	}
+	root, err := parseCARHeader(header)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("failed to parse car header: %w", err)
+	}
+
+	for {
+		section, err := readCARSection(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return cid.Undef, xerrors.Errorf("failed to read car section: %w", err)
+		}
+		n, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("failed to read block cid: %w", err)
+		}
+		data := section[n:]
+		if sum, err := c.Prefix().Sum(data); err != nil {
+			return cid.Undef, xerrors.Errorf("failed to hash block %v: %w", c, err)
+		} else if !sum.Equals(c) {
+			return cid.Undef, xerrors.Errorf("block data doesn't match cid %v", c)
+		}
+		stored, err := s.Put(s.Context(), &cbg.Deferred{Raw: data})
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("failed to store block %v: %w", c, err)
+		}
+		if !stored.Equals(c) {
+			return cid.Undef, xerrors.Errorf("store addressed block %v as %v", c, stored)
+		}
+	}
+	return root, nil
+}
+
+func writeCARHeader(w io.Writer, root cid.Cid) error {
+	// A DAG-CBOR map {"roots": [root], "version": 1}, with keys in canonical order.
+	var buf bytes.Buffer
+	if err := cbg.CborWriteHeader(&buf, cbg.MajMap, 2); err != nil {
+		return err
+	}
+	if err := writeCBORString(&buf, "roots"); err != nil {
+		return err
+	}
+	if err := cbg.CborWriteHeader(&buf, cbg.MajArray, 1); err != nil {
+		return err
+	}
+	if err := cbg.WriteCid(&buf, root); err != nil {
+		return err
+	}
+	if err := writeCBORString(&buf, "version"); err != nil {
+		return err
+	}
+	if err := cbg.CborWriteHeader(&buf, cbg.MajUnsignedInt, 1); err != nil {
+		return err
+	}
+	return writeUvarintPrefixed(w, buf.Bytes())
+}
+
+func parseCARHeader(header []byte) (cid.Cid, error) {
+	r := bytes.NewReader(header)
+	maj, fields, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return cid.Undef, err
+	} else if maj != cbg.MajMap {
+		return cid.Undef, xerrors.Errorf("expected map, got major type %d", maj)
+	}
+	root := cid.Undef
+	version := uint64(0)
+	for i := uint64(0); i < fields; i++ {
+		name, err := cbg.ReadString(r)
+		if err != nil {
+			return cid.Undef, err
+		}
+		switch name {
+		case "roots":
+			maj, n, err := cbg.CborReadHeader(r)
+			if err != nil {
+				return cid.Undef, err
+			} else if maj != cbg.MajArray || n != 1 {
+				return cid.Undef, xerrors.Errorf("expected exactly one root")
+			}
+			if root, err = cbg.ReadCid(r); err != nil {
+				return cid.Undef, err
+			}
+		case "version":
+			maj, v, err := cbg.CborReadHeader(r)
+			if err != nil {
+				return cid.Undef, err
+			} else if maj != cbg.MajUnsignedInt {
+				return cid.Undef, xerrors.Errorf("expected integer version, got major type %d", maj)
+			}
+			version = v
+		default:
+			return cid.Undef, xerrors.Errorf("unexpected header field %q", name)
+		}
+	}
+	if version != 1 {
+		return cid.Undef, xerrors.Errorf("unsupported car version %d", version)
+	}
+	if !root.Defined() {
+		return cid.Undef, xerrors.Errorf("missing root")
+	}
+	return root, nil
+}
+
+func writeCARSection(w io.Writer, c cid.Cid, data []byte) error {
+	return writeUvarintPrefixed(w, append(c.Bytes(), data...))
+}
+
+// Reads a uvarint length-prefixed section, returning io.EOF if the reader is exhausted before the section starts.
+func readCARSection(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, err
+	}
+	if length > maxCARSectionSize {
+		return nil, xerrors.Errorf("section length %d exceeds maximum %d", length, maxCARSectionSize)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func writeUvarintPrefixed(w io.Writer, data []byte) error {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	if _, err := w.Write(prefix[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writeCBORString(w io.Writer, s string) error {
+	if err := cbg.CborWriteHeader(w, cbg.MajTextString, uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -0,0 +1,71 @@
+package adt_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestMapCARRoundTrip(t *testing.T) {
+	source := adt.NewMemStore()
+	// A narrow bitwidth, so the map has many nodes.
+	m, err := adt.MakeEmptyMap(source, 2)
+	require.NoError(t, err)
+	for i := uint64(0); i < 200; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	root := tutil.MustRoot(t, m)
+	stats, err := m.Stats()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, m.ExportCAR(&buf))
+
+	dest := adt.NewMemStore()
+	imported, err := adt.ImportMapCAR(dest, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, root, imported)
+	assert.Equal(t, int(stats.NodeCount), dest.Len())
+
+	newValue := func() cbor.Unmarshaler { return new(abi.TokenAmount) }
+	expected, err := m.ToGoMap(newValue)
+	require.NoError(t, err)
+	restored, err := adt.AsMap(dest, imported, 2)
+	require.NoError(t, err)
+	actual, err := restored.ToGoMap(newValue)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	t.Run("empty map", func(t *testing.T) {
+		empty, err := adt.MakeEmptyMap(source, 2)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, empty.ExportCAR(&buf))
+		imported, err := adt.ImportMapCAR(adt.NewMemStore(), &buf)
+		require.NoError(t, err)
+		assert.Equal(t, tutil.MustRoot(t, empty), imported)
+	})
+
+	t.Run("corrupt archives are rejected", func(t *testing.T) {
+		data := buf.Bytes()
+		// Truncated.
+		_, err := adt.ImportMapCAR(adt.NewMemStore(), bytes.NewReader(data[:len(data)-1]))
+		assert.Error(t, err)
+		// Block data altered.
+		altered := append([]byte{}, data...)
+		altered[len(altered)-1] ^= 0xff
+		_, err = adt.ImportMapCAR(adt.NewMemStore(), bytes.NewReader(altered))
+		assert.Error(t, err)
+		// No header.
+		_, err = adt.ImportMapCAR(adt.NewMemStore(), bytes.NewReader(nil))
+		assert.Error(t, err)
+	})
+}
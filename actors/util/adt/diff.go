@@ -0,0 +1,108 @@
+package adt
+
+import (
+	"bytes"
+
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Computes the keys added, removed, and changed between two HAMT roots with the same bitwidth.
+// A key is changed if it is present in both maps with different serialized values.
+// Keys in each result are in the HAMT traversal order of the map in which they are present.
+func MapDiff(s Store, before, after cid.Cid, bitwidth int) (added, removed, changed []string, err error) {
+	if before.Equals(after) {
+		return nil, nil, nil, nil
+	}
+	beforeMap, err := AsMap(s, before, bitwidth)
+	if err != nil {
+		return nil, nil, nil, xerrors.Errorf("failed to load before map %v: %w", before, err)
+	}
+	afterMap, err := AsMap(s, after, bitwidth)
+	if err != nil {
+		return nil, nil, nil, xerrors.Errorf("failed to load after map %v: %w", after, err)
+	}
+
+	ctx := s.Context()
+	err = afterMap.root.ForEach(ctx, func(k string, val *cbg.Deferred) error {
+		found, raw, err := beforeMap.root.FindRaw(ctx, k)
+		if err != nil {
+			return xerrors.Errorf("failed to get key %v in node %v: %w", k, before, err)
+		}
+		if !found {
+			added = append(added, k)
+		} else if !bytes.Equal(raw, val.Raw) {
+			changed = append(changed, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = beforeMap.root.ForEach(ctx, func(k string, _ *cbg.Deferred) error {
+		found, err := afterMap.root.Find(ctx, k, nil)
+		if err != nil {
+			return xerrors.Errorf("failed to get key %v in node %v: %w", k, after, err)
+		}
+		if !found {
+			removed = append(removed, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return added, removed, changed, nil
+}
+
+// Computes the indices added, removed, and changed between two AMT roots with the same bitwidth.
+// An index is changed if it is populated in both arrays with different serialized values.
+// Indices in each result are in ascending order.
+func ArrayDiff(s Store, before, after cid.Cid, bitwidth int) (added, removed, changed []uint64, err error) {
+	if before.Equals(after) {
+		return nil, nil, nil, nil
+	}
+	beforeArr, err := AsArray(s, before, bitwidth)
+	if err != nil {
+		return nil, nil, nil, xerrors.Errorf("failed to load before array %v: %w", before, err)
+	}
+	afterArr, err := AsArray(s, after, bitwidth)
+	if err != nil {
+		return nil, nil, nil, xerrors.Errorf("failed to load after array %v: %w", after, err)
+	}
+
+	ctx := s.Context()
+	err = afterArr.root.ForEach(ctx, func(i uint64, val *cbg.Deferred) error {
+		var prior cbg.Deferred
+		found, err := beforeArr.root.Get(ctx, i, &prior)
+		if err != nil {
+			return xerrors.Errorf("failed to get index %v in array %v: %w", i, before, err)
+		}
+		if !found {
+			added = append(added, i)
+		} else if !bytes.Equal(prior.Raw, val.Raw) {
+			changed = append(changed, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = beforeArr.root.ForEach(ctx, func(i uint64, _ *cbg.Deferred) error {
+		found, err := afterArr.root.Get(ctx, i, nil)
+		if err != nil {
+			return xerrors.Errorf("failed to get index %v in array %v: %w", i, after, err)
+		}
+		if !found {
+			removed = append(removed, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return added, removed, changed, nil
+}
@@ -0,0 +1,124 @@
+package adt_test
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/mock"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestMapDiff(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	storeMap := func(entries map[uint64]int64) *adt.Map {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for k, v := range entries {
+			v := abi.NewTokenAmount(v)
+			require.NoError(t, m.Put(abi.UIntKey(k), &v))
+		}
+		return m
+	}
+	keys := func(ks ...uint64) []string {
+		var out []string
+		for _, k := range ks {
+			out = append(out, abi.UIntKey(k).Key())
+		}
+		return out
+	}
+
+	t.Run("identical roots", func(t *testing.T) {
+		root := tutil.MustRoot(t, storeMap(map[uint64]int64{1: 1}))
+		added, removed, changed, err := adt.MapDiff(store, root, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Empty(t, removed)
+		assert.Empty(t, changed)
+	})
+
+	t.Run("added, removed, and changed", func(t *testing.T) {
+		before := tutil.MustRoot(t, storeMap(map[uint64]int64{1: 1, 2: 2, 3: 3}))
+		after := tutil.MustRoot(t, storeMap(map[uint64]int64{2: 2, 3: 30, 4: 4, 5: 5}))
+		added, removed, changed, err := adt.MapDiff(store, before, after, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, keys(4, 5), added)
+		assert.ElementsMatch(t, keys(1), removed)
+		assert.ElementsMatch(t, keys(3), changed)
+	})
+
+	t.Run("from and to empty map", func(t *testing.T) {
+		empty := tutil.MustRoot(t, storeMap(nil))
+		full := tutil.MustRoot(t, storeMap(map[uint64]int64{1: 1, 2: 2}))
+
+		added, removed, changed, err := adt.MapDiff(store, empty, full, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, keys(1, 2), added)
+		assert.Empty(t, removed)
+		assert.Empty(t, changed)
+
+		added, removed, changed, err = adt.MapDiff(store, full, empty, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.ElementsMatch(t, keys(1, 2), removed)
+		assert.Empty(t, changed)
+	})
+}
+
+func TestArrayDiff(t *testing.T) {
+	const arrayBitwidth = 3
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	storeArray := func(entries map[uint64]int64) cid.Cid {
+		arr, err := adt.MakeEmptyArray(store, arrayBitwidth)
+		require.NoError(t, err)
+		for i, v := range entries {
+			v := abi.NewTokenAmount(v)
+			require.NoError(t, arr.Set(i, &v))
+		}
+		return tutil.MustRoot(t, arr)
+	}
+
+	t.Run("identical roots", func(t *testing.T) {
+		root := storeArray(map[uint64]int64{1: 1})
+		added, removed, changed, err := adt.ArrayDiff(store, root, root, arrayBitwidth)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Empty(t, removed)
+		assert.Empty(t, changed)
+	})
+
+	t.Run("added, removed, and changed", func(t *testing.T) {
+		before := storeArray(map[uint64]int64{1: 1, 2: 2, 3: 3, 1000: 1000})
+		after := storeArray(map[uint64]int64{2: 2, 3: 30, 4: 4, 500: 500, 1000: 1})
+		added, removed, changed, err := adt.ArrayDiff(store, before, after, arrayBitwidth)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{4, 500}, added)
+		assert.Equal(t, []uint64{1}, removed)
+		assert.Equal(t, []uint64{3, 1000}, changed)
+	})
+
+	t.Run("from and to empty array", func(t *testing.T) {
+		empty := storeArray(nil)
+		full := storeArray(map[uint64]int64{1: 1, 2: 2})
+
+		added, removed, changed, err := adt.ArrayDiff(store, empty, full, arrayBitwidth)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2}, added)
+		assert.Empty(t, removed)
+		assert.Empty(t, changed)
+
+		added, removed, changed, err = adt.ArrayDiff(store, full, empty, arrayBitwidth)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Equal(t, []uint64{1, 2}, removed)
+		assert.Empty(t, changed)
+	})
+}
@@ -0,0 +1,31 @@
+package adt_test
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+// Guards the serialization of values commonly stored in collections.
+func TestCollectionValueSerialization(t *testing.T) {
+	t.Run("balance table token amount", func(t *testing.T) {
+		v := abi.NewTokenAmount(1_000_000_000_000_000_000)
+		tutil.AssertCBORRoundTrip(t, &v)
+	})
+	t.Run("negative big int", func(t *testing.T) {
+		v := big.NewInt(-12345)
+		tutil.AssertCBORRoundTrip(t, &v)
+	})
+	t.Run("multimap array root", func(t *testing.T) {
+		v := cbg.CborCid(tutil.MakeCID("array", nil))
+		tutil.AssertCBORRoundTrip(t, &v)
+	})
+	t.Run("integer", func(t *testing.T) {
+		v := cbg.CborInt(-(1 << 40))
+		tutil.AssertCBORRoundTrip(t, &v)
+	})
+}
@@ -0,0 +1,143 @@
+package adt
+
+import (
+	"context"
+	"sync/atomic"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// Counts of operations performed by an InstrumentedStore.
+type StoreStats struct {
+	Gets    uint64 // Blocks retrieved, including those retrieved by GetMany and TryGet.
+	Puts    uint64 // Blocks written.
+	Has     uint64 // Checks for a block.
+	Deletes uint64 // Blocks deleted.
+}
+
+// InstrumentedStore is a Store counting the operations it passes to an underlying store,
+// e.g. to measure the block reads and writes performed by an operation on a collection.
+// It's a BatchStore or a DeleteStore exactly when the underlying store is, so collections use it just as they
+// would the underlying store. It's always a HasStore and a TryGetStore, falling back as Has and TryGet do.
+// It's safe for concurrent use if the underlying store is.
+type InstrumentedStore interface {
+	HasStore
+	TryGetStore
+	// Returns the counts of operations performed so far.
+	Stats() StoreStats
+	// Resets all counts to zero.
+	Reset()
+}
+
+// Creates a new store counting operations on `underlying`.
+func NewInstrumentedStore(underlying Store) InstrumentedStore {
+	s := &instrumentedStore{underlying: underlying}
+	_, batch := underlying.(BatchStore)
+	_, del := underlying.(DeleteStore)
+	switch {
+	case batch && del:
+		return instrumentedBatchDeleteStore{s}
+	case batch:
+		return instrumentedBatchStore{s}
+	case del:
+		return instrumentedDeleteStore{s}
+	default:
+		return s
+	}
+}
+
+type instrumentedStore struct {
+	underlying Store
+	gets       uint64
+	puts       uint64
+	has        uint64
+	deletes    uint64
+}
+
+func (s *instrumentedStore) Context() context.Context {
+	return s.underlying.Context()
+}
+
+func (s *instrumentedStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	atomic.AddUint64(&s.gets, 1)
+	return s.underlying.Get(ctx, c, out)
+}
+
+func (s *instrumentedStore) TryGet(ctx context.Context, c cid.Cid, out interface{}) (bool, error) {
+	atomic.AddUint64(&s.gets, 1)
+	return TryGet(ctx, s.underlying, c, out)
+}
+
+func (s *instrumentedStore) Put(ctx context.Context, v interface{}) (cid.Cid, error) {
+	atomic.AddUint64(&s.puts, 1)
+	return s.underlying.Put(ctx, v)
+}
+
+func (s *instrumentedStore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	atomic.AddUint64(&s.has, 1)
+	return Has(ctx, s.underlying, c)
+}
+
+func (s *instrumentedStore) getMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	atomic.AddUint64(&s.gets, uint64(len(cids)))
+	return s.underlying.(BatchStore).GetMany(ctx, cids, out)
+}
+
+func (s *instrumentedStore) delete(ctx context.Context, c cid.Cid) error {
+	atomic.AddUint64(&s.deletes, 1)
+	return s.underlying.(DeleteStore).Delete(ctx, c)
+}
+
+func (s *instrumentedStore) Stats() StoreStats {
+	return StoreStats{
+		Gets:    atomic.LoadUint64(&s.gets),
+		Puts:    atomic.LoadUint64(&s.puts),
+		Has:     atomic.LoadUint64(&s.has),
+		Deletes: atomic.LoadUint64(&s.deletes),
+	}
+}
+
+func (s *instrumentedStore) Reset() {
+	atomic.StoreUint64(&s.gets, 0)
+	atomic.StoreUint64(&s.puts, 0)
+	atomic.StoreUint64(&s.has, 0)
+	atomic.StoreUint64(&s.deletes, 0)
+}
+
+// An instrumented store over a BatchStore.
+type instrumentedBatchStore struct {
+	*instrumentedStore
+}
+
+var _ BatchStore = instrumentedBatchStore{}
+
+func (s instrumentedBatchStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	return s.getMany(ctx, cids, out)
+}
+
+// An instrumented store over a DeleteStore.
+type instrumentedDeleteStore struct {
+	*instrumentedStore
+}
+
+var _ DeleteStore = instrumentedDeleteStore{}
+
+func (s instrumentedDeleteStore) Delete(ctx context.Context, c cid.Cid) error {
+	return s.delete(ctx, c)
+}
+
+// An instrumented store over a store that is both a BatchStore and a DeleteStore.
+type instrumentedBatchDeleteStore struct {
+	*instrumentedStore
+}
+
+var _ BatchStore = instrumentedBatchDeleteStore{}
+var _ DeleteStore = instrumentedBatchDeleteStore{}
+
+func (s instrumentedBatchDeleteStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	return s.getMany(ctx, cids, out)
+}
+
+func (s instrumentedBatchDeleteStore) Delete(ctx context.Context, c cid.Cid) error {
+	return s.delete(ctx, c)
+}
@@ -0,0 +1,132 @@
+package adt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestInstrumentedStore(t *testing.T) {
+	store := adt.NewInstrumentedStore(adt.NewMemStore())
+	assert.Equal(t, adt.StoreStats{}, store.Stats())
+
+	v := abi.NewTokenAmount(1)
+	c, err := store.Put(store.Context(), &v)
+	require.NoError(t, err)
+	var out abi.TokenAmount
+	require.NoError(t, store.Get(store.Context(), c, &out))
+	require.NoError(t, adt.GetMany(context.Background(), store, []cid.Cid{c, c}, []interface{}{&out, &out}))
+	found, err := adt.Has(context.Background(), store, c)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, adt.StoreStats{Gets: 3, Puts: 1, Has: 1}, store.Stats())
+
+	store.Reset()
+	assert.Equal(t, adt.StoreStats{}, store.Stats())
+}
+
+func TestInstrumentedStoreCapabilities(t *testing.T) {
+	mem := adt.NewMemStore()
+	v := abi.NewTokenAmount(1)
+	c, err := mem.Put(mem.Context(), &v)
+	require.NoError(t, err)
+
+	// Batch reads and deletes are passed to a store supporting them, and counted.
+	store := adt.NewInstrumentedStore(mem)
+	var out abi.TokenAmount
+	bs, ok := store.(adt.BatchStore)
+	require.True(t, ok)
+	require.NoError(t, bs.GetMany(store.Context(), []cid.Cid{c, c}, []interface{}{&out, &out}))
+	found, err := adt.TryGet(store.Context(), store, c, &out)
+	require.NoError(t, err)
+	assert.True(t, found)
+	ds, ok := store.(adt.DeleteStore)
+	require.True(t, ok)
+	require.NoError(t, ds.Delete(store.Context(), c))
+	found, err = mem.Has(mem.Context(), c)
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = adt.TryGet(store.Context(), store, c, &out)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, adt.StoreStats{Gets: 4, Deletes: 1}, store.Stats())
+
+	// But not claimed over a store without them.
+	plain := adt.NewInstrumentedStore(plainStore{mem})
+	_, ok = plain.(adt.BatchStore)
+	assert.False(t, ok)
+	_, ok = plain.(adt.DeleteStore)
+	assert.False(t, ok)
+	batchOnly := adt.NewInstrumentedStore(batchOnlyStore{plainStore{mem}})
+	_, ok = batchOnly.(adt.BatchStore)
+	assert.True(t, ok)
+	_, ok = batchOnly.(adt.DeleteStore)
+	assert.False(t, ok)
+	deleteOnly := adt.NewInstrumentedStore(deleteOnlyStore{plainStore{mem}})
+	_, ok = deleteOnly.(adt.BatchStore)
+	assert.False(t, ok)
+	_, ok = deleteOnly.(adt.DeleteStore)
+	assert.True(t, ok)
+}
+
+// Exposes only the BatchStore extension of the store it wraps.
+type batchOnlyStore struct {
+	plainStore
+}
+
+func (s batchOnlyStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	return adt.GetMany(ctx, s.Store, cids, out)
+}
+
+// Exposes only the DeleteStore extension of the store it wraps.
+type deleteOnlyStore struct {
+	plainStore
+}
+
+func (s deleteOnlyStore) Delete(ctx context.Context, c cid.Cid) error {
+	return s.Store.(adt.DeleteStore).Delete(ctx, c)
+}
+
+func TestInstrumentedStoreCountsCollectionWrites(t *testing.T) {
+	store := adt.NewInstrumentedStore(adt.NewMemStore())
+	entries := make([]adt.MapEntry, 100)
+	for i := range entries {
+		v := abi.NewTokenAmount(int64(i))
+		entries[i] = adt.MapEntry{Key: abi.UIntKey(uint64(i)), Value: &v}
+	}
+
+	// Flushing after every put writes a new root each time.
+	looped, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NoError(t, looped.Put(e.Key, e.Value))
+		_, err = looped.Root()
+		require.NoError(t, err)
+	}
+	loopedPuts := store.Stats().Puts
+	assert.True(t, loopedPuts >= uint64(len(entries)))
+
+	// A batch flushed once writes only the final nodes.
+	store.Reset()
+	batched, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	require.NoError(t, batched.PutBatch(entries))
+	assert.Equal(t, uint64(0), store.Stats().Puts)
+	root := tutil.MustRoot(t, batched)
+	batchedPuts := store.Stats().Puts
+	assert.True(t, batchedPuts < loopedPuts)
+	assert.Equal(t, tutil.MustRoot(t, looped), root)
+
+	// Each node of the final tree is written once.
+	stats, err := batched.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, stats.NodeCount, batchedPuts)
+}
@@ -0,0 +1,45 @@
+package adt
+
+import (
+	"encoding/binary"
+
+	addr "github.com/filecoin-project/go-address"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Parses a key produced by abi.AddrKey back into an address.
+func ParseAddrKey(k string) (addr.Address, error) {
+	return addr.NewFromBytes([]byte(k))
+}
+
+// Parses a key produced by abi.CidKey back into a CID.
+func ParseCidKey(k string) (cid.Cid, error) {
+	return cid.Cast([]byte(k))
+}
+
+// Adapts an already-encoded key, such as one passed to a ForEach callback, as a Keyer.
+type stringKey string
+
+func (k stringKey) Key() string {
+	return string(k)
+}
+
+// Adapts a uint64 as a mapping key with a fixed-width, big-endian encoding.
+// Unlike abi.UIntKey, the lexicographic order of keys matches the numeric order of the integers,
+// at the cost of always occupying eight bytes.
+type PaddedUIntKey uint64
+
+func (k PaddedUIntKey) Key() string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(k))
+	return string(buf[:])
+}
+
+// Parses a key produced by PaddedUIntKey back into an integer.
+func ParsePaddedUIntKey(k string) (uint64, error) {
+	if len(k) != 8 {
+		return 0, xerrors.Errorf("padded integer key has length %d, expected 8", len(k))
+	}
+	return binary.BigEndian.Uint64([]byte(k)), nil
+}
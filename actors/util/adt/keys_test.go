@@ -0,0 +1,112 @@
+package adt_test
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestAddrKey(t *testing.T) {
+	for _, a := range []address.Address{
+		tutil.NewIDAddr(t, 0),
+		tutil.NewIDAddr(t, 1<<63-1),
+		tutil.NewSECP256K1Addr(t, "secp"),
+		tutil.NewBLSAddr(t, 1),
+		tutil.NewActorAddr(t, "actor"),
+	} {
+		parsed, err := adt.ParseAddrKey(abi.AddrKey(a).Key())
+		require.NoError(t, err)
+		assert.Equal(t, a, parsed)
+	}
+
+	_, err := adt.ParseAddrKey("\x09invalid")
+	assert.Error(t, err)
+}
+
+func TestCidKey(t *testing.T) {
+	for _, c := range []cid.Cid{
+		tutil.MakeCID("default", nil),
+		tutil.MakeCID("v0", &cid.Prefix{Version: 0, Codec: cid.DagProtobuf, MhType: mh.SHA2_256, MhLength: -1}),
+		tutil.MakeCID("v1-cbor-sha256", &cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: mh.SHA2_256, MhLength: -1}),
+		tutil.MakeCID("v1-raw-blake2b", &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.BLAKE2B_MIN + 31, MhLength: -1}),
+		tutil.MakeCID("v1-cbor-identity", &cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: mh.IDENTITY, MhLength: -1}),
+	} {
+		k := abi.CidKey(c).Key()
+		assert.Equal(t, c.Bytes(), []byte(k))
+		parsed, err := adt.ParseCidKey(k)
+		require.NoError(t, err)
+		assert.Equal(t, c, parsed)
+	}
+
+	_, err := adt.ParseCidKey("not a cid")
+	assert.Error(t, err)
+}
+
+// Integer keys are provided by abi; these tests pin the compact encoding that map keys rely on.
+func TestIntegerKeys(t *testing.T) {
+	t.Run("unsigned", func(t *testing.T) {
+		for _, tc := range []struct {
+			value uint64
+			size  int
+		}{{0, 1}, {127, 1}, {128, 2}, {1<<32 - 1, 5}, {math.MaxUint64, 10}} {
+			k := abi.UIntKey(tc.value).Key()
+			assert.Len(t, k, tc.size)
+			parsed, err := abi.ParseUIntKey(k)
+			require.NoError(t, err)
+			assert.Equal(t, tc.value, parsed)
+		}
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		for _, tc := range []struct {
+			value int64
+			size  int
+		}{{0, 1}, {-1, 1}, {63, 1}, {-64, 1}, {64, 2}, {math.MaxInt64, 10}, {math.MinInt64, 10}} {
+			k := abi.IntKey(tc.value).Key()
+			assert.Len(t, k, tc.size)
+			parsed, err := abi.ParseIntKey(k)
+			require.NoError(t, err)
+			assert.Equal(t, tc.value, parsed)
+		}
+	})
+
+	t.Run("trailing bytes", func(t *testing.T) {
+		_, err := abi.ParseUIntKey(abi.UIntKey(1).Key() + "x")
+		assert.Error(t, err)
+		_, err = abi.ParseIntKey(abi.IntKey(1).Key() + "x")
+		assert.Error(t, err)
+	})
+}
+
+func TestPaddedUIntKey(t *testing.T) {
+	values := []uint64{math.MaxUint64, 256, 0, 1 << 40, 255, 1, 65536, 128, 127}
+	var keys []string
+	for _, v := range values {
+		k := adt.PaddedUIntKey(v).Key()
+		assert.Len(t, k, 8)
+		parsed, err := adt.ParsePaddedUIntKey(k)
+		require.NoError(t, err)
+		assert.Equal(t, v, parsed)
+		keys = append(keys, k)
+	}
+
+	// Sorting the keys sorts the values.
+	sort.Strings(keys)
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for i, k := range keys {
+		assert.Equal(t, adt.PaddedUIntKey(values[i]).Key(), k)
+	}
+
+	_, err := adt.ParsePaddedUIntKey(abi.UIntKey(1).Key())
+	assert.Error(t, err)
+}
@@ -2,7 +2,11 @@ package adt
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	hamt "github.com/filecoin-project/go-hamt-ipld/v3"
 	"github.com/filecoin-project/go-state-types/abi"
@@ -21,15 +25,29 @@ var DefaultHamtOptions = []hamt.Option{
 	}),
 }
 
+// ErrNotFound is wrapped by errors reporting that an expected key or index is absent.
+// Lookups that may legitimately miss return a found flag rather than this error.
+var ErrNotFound = xerrors.New("not found")
+
+// StopIteration may be returned from an iteration callback to halt iteration early without error.
+// The iterating method then returns nil.
+var StopIteration = xerrors.New("stop iteration")
+
 // Map stores key-value pairs in a HAMT.
+// The root node is held in memory and loaded child nodes are cached, so a sequence of operations loads each node
+// from the store at most once. Changes are not persisted until Root() is called.
 type Map struct {
-	lastCid cid.Cid
-	root    *hamt.Node
-	store   Store
+	lastCid  cid.Cid
+	root     *hamt.Node
+	store    Store
+	bitwidth int
+	dirty    bool // Whether the root has been mutated since lastCid was loaded or written.
 }
 
 // AsMap interprets a store as a HAMT-based map with root `r`.
 // The HAMT is interpreted with branching factor 2^bitwidth.
+// The bitwidth is not recorded in the HAMT itself, so it must be the same as that with which the map was created.
+// Loading a map with a different bitwidth succeeds, but subsequent operations will give incorrect results.
 // We could drop this parameter if https://github.com/filecoin-project/go-hamt-ipld/issues/79 is implemented.
 func AsMap(s Store, root cid.Cid, bitwidth int) (*Map, error) {
 	options := append(DefaultHamtOptions, hamt.UseTreeBitWidth(bitwidth))
@@ -39,13 +57,15 @@ func AsMap(s Store, root cid.Cid, bitwidth int) (*Map, error) {
 	}
 
 	return &Map{
-		lastCid: root,
-		root:    nd,
-		store:   s,
+		lastCid:  root,
+		root:     nd,
+		store:    s,
+		bitwidth: bitwidth,
 	}, nil
 }
 
 // Creates a new map backed by an empty HAMT.
+// The HAMT has branching factor 2^bitwidth.
 func MakeEmptyMap(s Store, bitwidth int) (*Map, error) {
 	options := append(DefaultHamtOptions, hamt.UseTreeBitWidth(bitwidth))
 	nd, err := hamt.NewNode(s, options...)
@@ -53,9 +73,10 @@ func MakeEmptyMap(s Store, bitwidth int) (*Map, error) {
 		return nil, err
 	}
 	return &Map{
-		lastCid: cid.Undef,
-		root:    nd,
-		store:   s,
+		lastCid:  cid.Undef,
+		root:     nd,
+		store:    s,
+		bitwidth: bitwidth,
 	}, nil
 }
 
@@ -68,8 +89,35 @@ func StoreEmptyMap(s Store, bitwidth int) (cid.Cid, error) {
 	return m.Root()
 }
 
+// Interprets a store as a HAMT-based map with root `r` if `r` is defined, or otherwise creates a new empty map.
+// A defined root that fails to load is an error, rather than being replaced with an empty map.
+func LoadOrCreateMap(s Store, r cid.Cid, bitwidth int) (*Map, error) {
+	if !r.Defined() {
+		return MakeEmptyMap(s, bitwidth)
+	}
+	m, err := AsMap(s, r, bitwidth)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load existing map %v: %w", r, err)
+	}
+	return m, nil
+}
+
+// Returns an independent copy of the map, such that mutations to either do not affect the other.
+// The copy shares all stored nodes with the original; only nodes cached in memory are duplicated.
+func (m *Map) Copy() *Map {
+	return &Map{
+		lastCid:  m.lastCid,
+		root:     m.root.Copy(),
+		store:    m.store,
+		bitwidth: m.bitwidth,
+		dirty:    m.dirty,
+	}
+}
+
 // Returns the root cid of underlying HAMT.
+// Mutations are applied to the in-memory root only, so this is where they are persisted.
 func (m *Map) Root() (cid.Cid, error) {
+	// Flush writes modified child nodes, but not the root node, which must be written separately.
 	if err := m.root.Flush(m.store.Context()); err != nil {
 		return cid.Undef, xerrors.Errorf("failed to flush map root: %w", err)
 	}
@@ -79,14 +127,102 @@ func (m *Map) Root() (cid.Cid, error) {
 		return cid.Undef, xerrors.Errorf("writing map root object: %w", err)
 	}
 	m.lastCid = c
+	m.dirty = false
 
 	return c, nil
 }
 
+// Returns whether the map has no changes pending since it was loaded or last written by Root,
+// in which case lastCid is its current root.
+func (m *Map) isClean() bool {
+	return m.lastCid.Defined() && !m.dirty
+}
+
+// IsEmpty returns whether the map has no entries.
+// This inspects only the root node, which is empty exactly when the HAMT holds no entries.
+func (m *Map) IsEmpty() bool {
+	return len(m.root.Pointers) == 0
+}
+
 // Put adds value `v` with key `k` to the hamt store.
 func (m *Map) Put(k abi.Keyer, v cbor.Marshaler) error {
+	m.dirty = true
 	if err := m.root.Set(m.store.Context(), k.Key(), v); err != nil {
-		return xerrors.Errorf("failed to set key %v value %v in node %v: %w", k.Key(), v, m.lastCid, err)
+		return xerrors.Errorf("failed to set key %v in node %v: %w", k.Key(), m.lastCid, err)
+	}
+	return nil
+}
+
+// Reads, modifies and writes back the value at `k`.
+// The current value, if present, is deserialized into `target`, which is otherwise left untouched. Then `mutate`
+// is called with whether the key was found, and the value it returns is put at `k`.
+// The write follows the same path through the HAMT as the read, so its nodes are loaded from the store only once.
+func (m *Map) Modify(k abi.Keyer, target cbor.Unmarshaler, mutate func(found bool) (cbor.Marshaler, error)) error {
+	found, err := m.Get(k, target)
+	if err != nil {
+		return err
+	}
+	v, err := mutate(found)
+	if err != nil {
+		return err
+	}
+	return m.Put(k, v)
+}
+
+// Adds `delta` to the integer value at `k`, treating a missing key as zero, and returns the new value.
+// The value must be a CBOR-encoded signed integer, as for cbg.CborInt. Overflow is an error.
+func (m *Map) Increment(k abi.Keyer, delta int64) (int64, error) {
+	var value cbg.CborInt
+	err := m.Modify(k, &value, func(bool) (cbor.Marshaler, error) {
+		sum := int64(value) + delta
+		if (delta > 0 && sum < int64(value)) || (delta < 0 && sum > int64(value)) {
+			return nil, xerrors.Errorf("incrementing %d by %d at key %v overflows", value, delta, k.Key())
+		}
+		value = cbg.CborInt(sum)
+		return &value, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(value), nil
+}
+
+// PutIfChanged adds value `v` with key `k` to the hamt store, unless the stored value is already identical.
+// Values are compared by their serialized bytes. Returns whether the value was written.
+// Note that Put of an identical value also leaves the HAMT unmodified, but does not report it.
+func (m *Map) PutIfChanged(k abi.Keyer, v cbor.Marshaler) (bool, error) {
+	var buf bytes.Buffer
+	if err := v.MarshalCBOR(&buf); err != nil {
+		return false, xerrors.Errorf("failed to marshal value for key %v: %w", k.Key(), err)
+	}
+	prev, found, err := m.GetRaw(k)
+	if err != nil {
+		return false, err
+	}
+	if found && bytes.Equal(prev, buf.Bytes()) {
+		return false, nil
+	}
+	m.dirty = true
+	if err := m.root.SetRaw(m.store.Context(), k.Key(), buf.Bytes()); err != nil {
+		return false, xerrors.Errorf("failed to set key %v in node %v: %w", k.Key(), m.lastCid, err)
+	}
+	return true, nil
+}
+
+// MapEntry is a key-value pair for batched map operations.
+type MapEntry struct {
+	Key   abi.Keyer
+	Value cbor.Marshaler
+}
+
+// PutBatch adds many entries to the hamt store, in order.
+// Later entries overwrite earlier ones with the same key.
+// Like Put, this modifies only the in-memory root; the new root is persisted once, by Root().
+func (m *Map) PutBatch(entries []MapEntry) error {
+	for _, e := range entries {
+		if err := m.Put(e.Key, e.Value); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -95,26 +231,79 @@ func (m *Map) Put(k abi.Keyer, v cbor.Marshaler) error {
 // Returns whether the key was found.
 func (m *Map) Get(k abi.Keyer, out cbor.Unmarshaler) (bool, error) {
 	if found, err := m.root.Find(m.store.Context(), k.Key(), out); err != nil {
-		return false, xerrors.Errorf("failed to get key %v in node %v: %w", m.lastCid, k.Key(), err)
+		return false, xerrors.Errorf("failed to get key %v in node %v: %w", k.Key(), m.lastCid, err)
 	} else {
 		return found, nil
 	}
 }
 
+// Retrieves the value at `k` into `out` if present, and otherwise populates `out` from `def`
+// by serializing and deserializing it.
+func (m *Map) GetWithDefault(k abi.Keyer, out cbor.Unmarshaler, def cbor.Marshaler) error {
+	if found, err := m.Get(k, out); err != nil {
+		return err
+	} else if found {
+		return nil
+	}
+	if err := copyCBOR(out, def); err != nil {
+		return xerrors.Errorf("failed to copy default for key %v: %w", k.Key(), err)
+	}
+	return nil
+}
+
+// Populates `out` from `in` by serializing and deserializing it.
+func copyCBOR(out cbor.Unmarshaler, in cbor.Marshaler) error {
+	var buf bytes.Buffer
+	if err := in.MarshalCBOR(&buf); err != nil {
+		return err
+	}
+	return out.UnmarshalCBOR(&buf)
+}
+
+// GetRaw retrieves the serialized value at `k`, if present.
+// Returns whether the key was found.
+func (m *Map) GetRaw(k abi.Keyer) ([]byte, bool, error) {
+	found, raw, err := m.root.FindRaw(m.store.Context(), k.Key())
+	if err != nil {
+		return nil, false, xerrors.Errorf("failed to get key %v in node %v: %w", k.Key(), m.lastCid, err)
+	}
+	return raw, found, nil
+}
+
+// PutRaw adds the serialized value `raw` with key `k` to the hamt store, without re-encoding it.
+// The value must be exactly one well-formed CBOR object.
+func (m *Map) PutRaw(k abi.Keyer, raw []byte) error {
+	r := bytes.NewReader(raw)
+	var d cbg.Deferred
+	if err := d.UnmarshalCBOR(r); err != nil {
+		return xerrors.Errorf("invalid raw value for key %v: %w", k.Key(), err)
+	} else if r.Len() != 0 {
+		return xerrors.Errorf("invalid raw value for key %v: %d trailing bytes", k.Key(), r.Len())
+	}
+	m.dirty = true
+	if err := m.root.SetRaw(m.store.Context(), k.Key(), raw); err != nil {
+		return xerrors.Errorf("failed to set key %v in node %v: %w", k.Key(), m.lastCid, err)
+	}
+	return nil
+}
+
 // Has checks for the existence of a key without deserializing its value.
 func (m *Map) Has(k abi.Keyer) (bool, error) {
 	if found, err := m.root.Find(m.store.Context(), k.Key(), nil); err != nil {
-		return false, xerrors.Errorf("failed to check key %v in node %v: %w", m.lastCid, k.Key(), err)
+		return false, xerrors.Errorf("failed to check key %v in node %v: %w", k.Key(), m.lastCid, err)
 	} else {
 		return found, nil
 	}
 }
 
-// Sets key key `k` to value `v` iff the key is not already present.
+// Sets key `k` to value `v` iff the key is not already present.
+// Returns whether the value was written.
 func (m *Map) PutIfAbsent(k abi.Keyer, v cbor.Marshaler) (bool, error) {
 	if modified, err := m.root.SetIfAbsent(m.store.Context(), k.Key(), v); err != nil {
-		return false, xerrors.Errorf("failed to set key %v value %v in node %v: %w", k.Key(), v, m.lastCid, err)
+		m.dirty = true // A failed write may have partially modified the root.
+		return false, xerrors.Errorf("failed to set key %v in node %v: %w", k.Key(), m.lastCid, err)
 	} else {
+		m.dirty = m.dirty || modified
 		return modified, nil
 	}
 }
@@ -123,8 +312,10 @@ func (m *Map) PutIfAbsent(k abi.Keyer, v cbor.Marshaler) (bool, error) {
 // Returns whether the key was previously present.
 func (m *Map) TryDelete(k abi.Keyer) (bool, error) {
 	if found, err := m.root.Delete(m.store.Context(), k.Key()); err != nil {
-		return false, xerrors.Errorf("failed to delete key %v in node %v: %v", k.Key(), m.root, err)
+		m.dirty = true // A failed delete may have partially modified the root.
+		return false, xerrors.Errorf("failed to delete key %v in node %v: %w", k.Key(), m.lastCid, err)
 	} else {
+		m.dirty = m.dirty || found
 		return found, nil
 	}
 }
@@ -132,19 +323,212 @@ func (m *Map) TryDelete(k abi.Keyer) (bool, error) {
 // Removes the value at `k` from the hamt store, expecting it to exist.
 func (m *Map) Delete(k abi.Keyer) error {
 	if found, err := m.root.Delete(m.store.Context(), k.Key()); err != nil {
-		return xerrors.Errorf("failed to delete key %v in node %v: %v", k.Key(), m.root, err)
+		m.dirty = true // A failed delete may have partially modified the root.
+		return xerrors.Errorf("failed to delete key %v in node %v: %w", k.Key(), m.lastCid, err)
 	} else if !found {
-		return xerrors.Errorf("no such key %v to delete in node %v", k.Key(), m.root)
+		return xerrors.Errorf("no such key %v to delete in node %v: %w", k.Key(), m.lastCid, ErrNotFound)
 	}
+	m.dirty = true
 	return nil
 }
 
+// Removes many keys from the hamt store, skipping any that are not present.
+// Returns the keys that were previously present, in the order given.
+func (m *Map) DeleteBatch(keys []abi.Keyer) ([]abi.Keyer, error) {
+	var deleted []abi.Keyer
+	for _, k := range keys {
+		found, err := m.TryDelete(k)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			deleted = append(deleted, k)
+		}
+	}
+	return deleted, nil
+}
+
 // Iterates all entries in the map, deserializing each value in turn into `out` and then
 // calling a function with the corresponding key.
-// Iteration halts if the function returns an error.
+// The same `out` is overwritten for every entry, so iteration allocates no decode targets, but the function must
+// copy anything it needs to retain (use ForEachValue to get a fresh target per entry instead).
+// Iteration halts if the function returns an error, which is returned unless it is StopIteration.
 // If the output parameter is nil, deserialization is skipped.
+// If the store is a BatchStore and the map has no pending changes, this prefetches like ForEachPrefetched.
 func (m *Map) ForEach(out cbor.Unmarshaler, fn func(key string) error) error {
-	return m.root.ForEach(m.store.Context(), func(k string, val *cbg.Deferred) error {
+	if _, ok := m.store.(BatchStore); ok && m.isClean() {
+		return m.ForEachPrefetched(out, fn)
+	}
+	return m.forEach(m.store.Context(), out, fn)
+}
+
+// Iterates all entries in the map like ForEach, but using `ctx` to load nodes from the store.
+// Iteration halts with the context's error as soon as the context is done.
+func (m *Map) ForEachWithContext(ctx context.Context, out cbor.Unmarshaler, fn func(key string) error) error {
+	return m.forEach(ctx, out, func(key string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(key)
+	})
+}
+
+// Iterates all entries in the map, deserializing each value into a fresh target obtained from `newValue` and then
+// calling a function with the corresponding key and the populated target.
+// Unlike ForEach, each value may be retained by the function after it returns.
+// Iteration halts if the function returns an error, which is returned unless it is StopIteration.
+func (m *Map) ForEachValue(newValue func() cbor.Unmarshaler, fn func(key string, value cbor.Unmarshaler) error) error {
+	err := m.root.ForEach(m.store.Context(), func(k string, val *cbg.Deferred) error {
+		value := newValue()
+		if err := value.UnmarshalCBOR(bytes.NewReader(val.Raw)); err != nil {
+			return err
+		}
+		return fn(k, value)
+	})
+	if xerrors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
+}
+
+// Iterates all entries in the map like ForEachValue, but traversing subtrees concurrently on up to `workers`
+// goroutines. Entries are visited exactly once each, in no particular order.
+// This is intended for offline analysis of large maps. It is safe only if the callback is safe for concurrent
+// use and nothing writes to the map or the blocks it reads while it runs.
+// Nodes are read from the store by their links, so the map must have no pending changes, as when freshly
+// loaded with AsMap or after a call to Root(). Otherwise this fails without visiting any entry.
+// The first error returned by the callback halts iteration and is returned unless it is StopIteration,
+// though calls already in progress on other goroutines will complete.
+func (m *Map) ForEachParallel(workers int, newValue func() cbor.Unmarshaler, fn func(key string, value cbor.Unmarshaler) error) error {
+	if workers < 1 {
+		return xerrors.Errorf("invalid worker count %d", workers)
+	}
+	// A child modified since it was loaded keeps its old link, so a dirty map can't be walked by links.
+	if !m.isClean() {
+		return xerrors.Errorf("map has pending changes")
+	}
+	ctx := m.store.Context()
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	var halted int32
+	halt := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		atomic.StoreInt32(&halted, 1)
+	}
+	// The calling goroutine is one of the workers.
+	spare := make(chan struct{}, workers-1)
+
+	var visit func(pointers []*hamt.Pointer)
+	load := func(c cid.Cid) {
+		var nd hamt.Node
+		if err := m.store.Get(ctx, c, &nd); err != nil {
+			halt(xerrors.Errorf("failed to load node %v: %w", c, err))
+			return
+		}
+		visit(nd.Pointers)
+	}
+	visit = func(pointers []*hamt.Pointer) {
+		for _, p := range pointers {
+			if atomic.LoadInt32(&halted) != 0 {
+				return
+			}
+			if len(p.KVs) > 0 {
+				for _, kv := range p.KVs {
+					value := newValue()
+					if err := value.UnmarshalCBOR(bytes.NewReader(kv.Value.Raw)); err != nil {
+						halt(err)
+						return
+					}
+					if err := fn(string(kv.Key), value); err != nil {
+						halt(err)
+						return
+					}
+				}
+			} else {
+				select {
+				case spare <- struct{}{}:
+					wg.Add(1)
+					go func(c cid.Cid) {
+						defer wg.Done()
+						defer func() { <-spare }()
+						load(c)
+					}(p.Link)
+				default:
+					load(p.Link)
+				}
+			}
+		}
+	}
+	visit(m.root.Pointers)
+	wg.Wait()
+
+	if xerrors.Is(firstErr, StopIteration) {
+		return nil
+	}
+	return firstErr
+}
+
+// Iterates all entries in the map like ForEach, in the same order, but fetching all the children of each node
+// from the store together before descending into them. With a BatchStore each set of children is fetched with a
+// single GetMany, which can hide much of the latency of a networked store. Other stores fetch them one at a time.
+// Nodes are read from the store by their links, so the map must have no pending changes, as when freshly
+// loaded with AsMap or after a call to Root(). Otherwise this fails without visiting any entry.
+func (m *Map) ForEachPrefetched(out cbor.Unmarshaler, fn func(key string) error) error {
+	// A child modified since it was loaded keeps its old link, so a dirty map can't be walked by links.
+	if !m.isClean() {
+		return xerrors.Errorf("map has pending changes")
+	}
+	err := m.forEachPrefetched(m.root.Pointers, out, fn)
+	if xerrors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
+}
+
+func (m *Map) forEachPrefetched(pointers []*hamt.Pointer, out cbor.Unmarshaler, fn func(key string) error) error {
+	var links []cid.Cid
+	for _, p := range pointers {
+		if len(p.KVs) == 0 {
+			links = append(links, p.Link)
+		}
+	}
+	children := make([]hamt.Node, len(links))
+	if len(links) > 0 {
+		targets := make([]interface{}, len(links))
+		for i := range children {
+			targets[i] = &children[i]
+		}
+		if err := GetMany(m.store.Context(), m.store, links, targets); err != nil {
+			return xerrors.Errorf("failed to load child nodes: %w", err)
+		}
+	}
+
+	nextChild := 0
+	for _, p := range pointers {
+		if len(p.KVs) == 0 {
+			if err := m.forEachPrefetched(children[nextChild].Pointers, out, fn); err != nil {
+				return err
+			}
+			nextChild++
+			continue
+		}
+		for _, kv := range p.KVs {
+			if out != nil {
+				if err := out.UnmarshalCBOR(bytes.NewReader(kv.Value.Raw)); err != nil {
+					return err
+				}
+			}
+			if err := fn(string(kv.Key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Map) forEach(ctx context.Context, out cbor.Unmarshaler, fn func(key string) error) error {
+	err := m.root.ForEach(ctx, func(k string, val *cbg.Deferred) error {
 		if out != nil {
 			// Why doesn't hamt.ForEach() just return the value as bytes?
 			err := out.UnmarshalCBOR(bytes.NewReader(val.Raw))
@@ -154,9 +538,270 @@ func (m *Map) ForEach(out cbor.Unmarshaler, fn func(key string) error) error {
 		}
 		return fn(k)
 	})
+	if xerrors.Is(err, StopIteration) {
+		return nil
+	}
+	return err
+}
+
+// Merges all entries from `other` into this map.
+// For keys present in both maps, `onConflict` is called with the existing and incoming raw values and returns the
+// value to store. If `onConflict` is nil, incoming values overwrite existing ones.
+// Non-conflicting entries are copied without re-encoding.
+func (m *Map) Merge(other *Map, onConflict func(key string, existing, incoming *cbg.Deferred) (cbor.Marshaler, error)) error {
+	ctx := m.store.Context()
+	return other.root.ForEach(other.store.Context(), func(k string, incoming *cbg.Deferred) error {
+		if onConflict != nil {
+			found, raw, err := m.root.FindRaw(ctx, k)
+			if err != nil {
+				return xerrors.Errorf("failed to get key %v in node %v: %w", k, m.lastCid, err)
+			}
+			if found {
+				v, err := onConflict(k, &cbg.Deferred{Raw: raw}, incoming)
+				if err != nil {
+					return err
+				}
+				m.dirty = true
+				if err := m.root.Set(ctx, k, v); err != nil {
+					return xerrors.Errorf("failed to set key %v in node %v: %w", k, m.lastCid, err)
+				}
+				return nil
+			}
+		}
+		m.dirty = true
+		if err := m.root.SetRaw(ctx, k, incoming.Raw); err != nil {
+			return xerrors.Errorf("failed to set key %v in node %v: %w", k, m.lastCid, err)
+		}
+		return nil
+	})
+}
+
+// Checks whether this map holds the same keys as `other`, with each pair of values satisfying `eq`.
+// If `eq` is nil, values are compared by their serialized bytes.
+// Maps with no pending changes and identical roots are equal without traversal. Otherwise the in-memory
+// maps are compared entry by entry, and neither is written to the store.
+func (m *Map) Equals(other *Map, eq func(a, b *cbg.Deferred) bool) (bool, error) {
+	if eq == nil {
+		eq = func(a, b *cbg.Deferred) bool {
+			return bytes.Equal(a.Raw, b.Raw)
+		}
+	}
+
+	if m.isClean() && other.isClean() && m.lastCid.Equals(other.lastCid) {
+		return true, nil
+	}
+
+	otherCount, err := other.Count()
+	if err != nil {
+		return false, err
+	}
+
+	equal := true
+	var count uint64
+	stopErr := xerrors.New("stop")
+	err = m.root.ForEach(m.store.Context(), func(k string, val *cbg.Deferred) error {
+		count++
+		found, raw, err := other.root.FindRaw(other.store.Context(), k)
+		if err != nil {
+			return xerrors.Errorf("failed to get key %v in node %v: %w", k, other.lastCid, err)
+		}
+		if !found || !eq(val, &cbg.Deferred{Raw: raw}) {
+			equal = false
+			return stopErr
+		}
+		return nil
+	})
+	if err != nil && err != stopErr {
+		return false, err
+	}
+	return equal && count == otherCount, nil
 }
 
-// Collects all the keys from the map into a slice of strings.
+// Iterates all entries in the map in lexicographic key order, deserializing each value in turn into `out` and
+// then calling a function with the corresponding key.
+// Unlike ForEach, the visitation order is independent of the HAMT's hash function and bitwidth.
+// This holds all the raw entries in memory in order to sort them.
+// Iteration halts if the function returns an error, which is returned unless it is StopIteration.
+// If the output parameter is nil, deserialization is skipped.
+func (m *Map) ForEachSorted(out cbor.Unmarshaler, fn func(key string) error) error {
+	var keys []string
+	values := map[string]*cbg.Deferred{}
+	if err := m.root.ForEach(m.store.Context(), func(k string, val *cbg.Deferred) error {
+		keys = append(keys, k)
+		values[k] = val
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if out != nil {
+			if err := out.UnmarshalCBOR(bytes.NewReader(values[k].Raw)); err != nil {
+				return err
+			}
+		}
+		if err := fn(k); xerrors.Is(err, StopIteration) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the structural integrity of the HAMT, returning an error describing the first violation found.
+// This loads every node, checking that each is well formed for the map's bitwidth and in canonical form,
+// and that every key is located where its hash places it. Values are not decoded.
+// Any pending changes are checked in memory, without writing to the store, so this works on a read-only store.
+func (m *Map) Validate() error {
+	ctx := m.store.Context()
+	return m.root.ForEach(ctx, func(k string, _ *cbg.Deferred) error {
+		found, err := m.root.Find(ctx, k, nil)
+		if err != nil {
+			return xerrors.Errorf("invalid map: failed to find key %v: %w", k, err)
+		} else if !found {
+			return xerrors.Errorf("invalid map: key %v is not located by its hash", k)
+		}
+		return nil
+	})
+}
+
+// MapStats summarizes the shape and size of a HAMT.
+type MapStats struct {
+	MaxDepth   uint64 // Number of nodes on the longest path from the root, including the root.
+	NodeCount  uint64 // Total number of nodes, including the root.
+	EntryCount uint64 // Total number of key-value pairs.
+	ByteSize   uint64 // Total serialized size of all nodes, in bytes.
+}
+
+// Computes statistics about the HAMT in a single traversal, without writing to the store.
+// Nodes with pending changes have no stored form to measure, so for a map with pending changes the stats
+// are instead computed from an equivalent HAMT built in a buffer over the store. This relies on the HAMT
+// having a canonical form, so matches the stats of the map once flushed, but costs a rebuild of the map.
+func (m *Map) Stats() (MapStats, error) {
+	var store Store = m.store
+	root := m.lastCid
+	if !m.isClean() {
+		ctx := m.store.Context()
+		buffer := NewBufferedStore(m.store)
+		nd, err := hamt.NewNode(buffer, append(DefaultHamtOptions, hamt.UseTreeBitWidth(m.bitwidth))...)
+		if err != nil {
+			return MapStats{}, err
+		}
+		if err := m.root.ForEach(ctx, func(k string, val *cbg.Deferred) error {
+			return nd.SetRaw(ctx, k, val.Raw)
+		}); err != nil {
+			return MapStats{}, xerrors.Errorf("failed to copy map: %w", err)
+		}
+		if err := nd.Flush(ctx); err != nil {
+			return MapStats{}, xerrors.Errorf("failed to flush map copy: %w", err)
+		}
+		if root, err = buffer.Put(ctx, nd); err != nil {
+			return MapStats{}, xerrors.Errorf("failed to write map copy: %w", err)
+		}
+		store = buffer
+	}
+	var stats MapStats
+	if err := addNodeStats(store, root, 1, &stats); err != nil {
+		return MapStats{}, err
+	}
+	return stats, nil
+}
+
+func addNodeStats(store Store, c cid.Cid, depth uint64, stats *MapStats) error {
+	var raw cbg.Deferred
+	if err := store.Get(store.Context(), c, &raw); err != nil {
+		return xerrors.Errorf("failed to load node %v: %w", c, err)
+	}
+	var nd hamt.Node
+	if err := nd.UnmarshalCBOR(bytes.NewReader(raw.Raw)); err != nil {
+		return xerrors.Errorf("failed to decode node %v: %w", c, err)
+	}
+
+	stats.NodeCount++
+	stats.ByteSize += uint64(len(raw.Raw))
+	if depth > stats.MaxDepth {
+		stats.MaxDepth = depth
+	}
+	for _, p := range nd.Pointers {
+		if p.Link.Defined() {
+			if err := addNodeStats(store, p.Link, depth+1, stats); err != nil {
+				return err
+			}
+		} else {
+			stats.EntryCount += uint64(len(p.KVs))
+		}
+	}
+	return nil
+}
+
+// Deletes from the store the HAMT nodes reachable from a previous root of this map, `reachableBefore`, but no
+// longer reachable from its current root, such as those orphaned by deletes. Any pending changes are first
+// persisted to the store. Only the map's own nodes are considered: blocks linked to from its values are untouched.
+// The store must be a DeleteStore, and must own the map's blocks, since a node shared with some other structure
+// would be deleted from under it.
+func (m *Map) CollectGarbage(reachableBefore cid.Cid) error {
+	ds, ok := m.store.(DeleteStore)
+	if !ok {
+		return xerrors.Errorf("can't collect garbage from %T, which is not a DeleteStore", m.store)
+	}
+	root, err := m.Root()
+	if err != nil {
+		return err
+	}
+	if root == reachableBefore {
+		return nil
+	}
+
+	live := make(map[cid.Cid]struct{})
+	if err := m.visitNodes(root, nil, func(c cid.Cid) error {
+		live[c] = struct{}{}
+		return nil
+	}); err != nil {
+		return xerrors.Errorf("failed to traverse current root %v: %w", root, err)
+	}
+	// A subtree whose root is live is wholly live, so need not be traversed.
+	var dead []cid.Cid
+	if err := m.visitNodes(reachableBefore, live, func(c cid.Cid) error {
+		dead = append(dead, c)
+		return nil
+	}); err != nil {
+		return xerrors.Errorf("failed to traverse previous root %v: %w", reachableBefore, err)
+	}
+	for _, c := range dead {
+		if err := ds.Delete(m.store.Context(), c); err != nil {
+			return xerrors.Errorf("failed to delete node %v: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// Calls `fn` with the CID of each HAMT node reachable from `c`, parents before children,
+// without descending into nodes in `skip`.
+func (m *Map) visitNodes(c cid.Cid, skip map[cid.Cid]struct{}, fn func(c cid.Cid) error) error {
+	if _, ok := skip[c]; ok {
+		return nil
+	}
+	var nd hamt.Node
+	if err := m.store.Get(m.store.Context(), c, &nd); err != nil {
+		return xerrors.Errorf("failed to load node %v: %w", c, err)
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	for _, p := range nd.Pointers {
+		if p.Link.Defined() {
+			if err := m.visitNodes(p.Link, skip, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Collects all the keys from the map into a slice of strings, without deserializing values.
+// Keys are returned in HAMT traversal order, which follows the key hashes rather than the keys themselves.
 func (m *Map) CollectKeys() (out []string, err error) {
 	err = m.ForEach(nil, func(key string) error {
 		out = append(out, key)
@@ -165,6 +810,47 @@ func (m *Map) CollectKeys() (out []string, err error) {
 	return
 }
 
+// Returns the number of entries in the map.
+// This traverses the whole HAMT but does not deserialize any values.
+func (m *Map) Count() (uint64, error) {
+	var count uint64
+	err := m.ForEach(nil, func(key string) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Returns the number of entries for which `match` returns true.
+// Each value is first deserialized into `out` (if non-nil), from which `match` may read it.
+func (m *Map) CountMatching(out cbor.Unmarshaler, match func(key string) bool) (uint64, error) {
+	var count uint64
+	err := m.ForEach(out, func(key string) error {
+		if match(key) {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Returns the key of the first entry, in HAMT traversal order, for which `match` returns true.
+// Each value is first deserialized into `out` (if non-nil), from which `match` may read it. If an entry is found,
+// `out` holds its value on return; otherwise its contents are unspecified.
+func (m *Map) FindFirst(out cbor.Unmarshaler, match func(key string) bool) (key string, found bool, err error) {
+	err = m.ForEach(out, func(k string) error {
+		if match(k) {
+			key, found = k, true
+			return StopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return key, found, nil
+}
+
 // Retrieves the value for `k` into the 'out' unmarshaler (if non-nil), and removes the entry.
 // Returns a boolean indicating whether the element was previously in the map.
 func (m *Map) Pop(k abi.Keyer, out cbor.Unmarshaler) (bool, error) {
@@ -173,10 +859,110 @@ func (m *Map) Pop(k abi.Keyer, out cbor.Unmarshaler) (bool, error) {
 		return found, err
 	}
 
+	m.dirty = true
 	if found, err := m.root.Delete(m.store.Context(), key); err != nil {
 		return false, err
 	} else if !found {
-		return false, xerrors.Errorf("failed to find key %v to delete", k.Key())
+		return false, xerrors.Errorf("failed to find key %v to delete: %w", k.Key(), ErrNotFound)
 	}
 	return true, nil
 }
+
+// Builds a new map, with the same bitwidth, holding this map's values under keys transformed by `mapKey`.
+// Values are copied without re-encoding. The original map is not modified.
+// Returns an error if two keys are transformed to the same new key.
+func (m *Map) Rekey(mapKey func(oldKey string) (abi.Keyer, error)) (*Map, error) {
+	result, err := MakeEmptyMap(m.store, m.bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	ctx := m.store.Context()
+	err = m.root.ForEach(ctx, func(k string, val *cbg.Deferred) error {
+		newKey, err := mapKey(k)
+		if err != nil {
+			return xerrors.Errorf("failed to rekey %x: %w", k, err)
+		}
+		if found, _, err := result.root.FindRaw(ctx, newKey.Key()); err != nil {
+			return xerrors.Errorf("failed to check new key %x: %w", newKey.Key(), err)
+		} else if found {
+			return xerrors.Errorf("key %x maps to new key %x, which is already present", k, newKey.Key())
+		}
+		if err := result.root.SetRaw(ctx, newKey.Key(), val.Raw); err != nil {
+			return xerrors.Errorf("failed to set new key %x: %w", newKey.Key(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Builds a new map, with the same keys and bitwidth, holding values produced by `transform` from each
+// serialized value of this map. The original map is not modified, and the new map is not written to the
+// store until its Root is requested.
+func (m *Map) MapValues(transform func(key string, raw []byte) (cbor.Marshaler, error)) (*Map, error) {
+	result, err := MakeEmptyMap(m.store, m.bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	ctx := m.store.Context()
+	err = m.root.ForEach(ctx, func(k string, val *cbg.Deferred) error {
+		v, err := transform(k, val.Raw)
+		if err != nil {
+			return xerrors.Errorf("failed to transform value for key %x: %w", k, err)
+		}
+		if err := result.root.Set(ctx, k, v); err != nil {
+			return xerrors.Errorf("failed to set key %x: %w", k, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Builds a new map, with the same bitwidth, holding just the entries for which `keep` returns true.
+// Each value is first deserialized into `out` (if non-nil), from which `keep` may read it. Kept values are copied
+// without re-encoding. The original map is not modified, and the new map is not written to the store until
+// its Root is requested.
+func (m *Map) Filter(out cbor.Unmarshaler, keep func(key string) bool) (*Map, error) {
+	result, err := MakeEmptyMap(m.store, m.bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	ctx := m.store.Context()
+	err = m.root.ForEach(ctx, func(k string, val *cbg.Deferred) error {
+		if out != nil {
+			if err := out.UnmarshalCBOR(bytes.NewReader(val.Raw)); err != nil {
+				return err
+			}
+		}
+		if !keep(k) {
+			return nil
+		}
+		if err := result.root.SetRaw(ctx, k, val.Raw); err != nil {
+			return xerrors.Errorf("failed to set key %x: %w", k, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Decodes every entry of the map into a fresh object from `newValue`, collecting them into a Go map by key.
+// This loads the whole map into memory, so is intended for tests and diagnostics.
+func (m *Map) ToGoMap(newValue func() cbor.Unmarshaler) (map[string]cbor.Unmarshaler, error) {
+	out := make(map[string]cbor.Unmarshaler)
+	err := m.ForEachValue(newValue, func(key string, value cbor.Unmarshaler) error {
+		out[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
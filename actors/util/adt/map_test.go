@@ -0,0 +1,1818 @@
+package adt_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	hamt "github.com/filecoin-project/go-hamt-ipld/v3"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/cbor"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
+	"github.com/filecoin-project/specs-actors/v5/support/mock"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestMapHas(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	found, err := m.Has(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	v := abi.NewTokenAmount(100)
+	require.NoError(t, m.Put(abi.UIntKey(1), &v))
+
+	found, err = m.Has(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = m.Has(abi.UIntKey(2))
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMapIsEmpty(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+
+	t.Run("new map is empty", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.True(t, m.IsEmpty())
+
+		// And after a round trip through the store.
+		m, err = adt.AsMap(store, tutil.MustRoot(t, m), builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.True(t, m.IsEmpty())
+	})
+
+	t.Run("empty after all entries deleted", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+
+		v := abi.NewTokenAmount(1)
+		require.NoError(t, m.Put(abi.UIntKey(1), &v))
+		assert.False(t, m.IsEmpty())
+
+		require.NoError(t, m.Delete(abi.UIntKey(1)))
+		assert.True(t, m.IsEmpty())
+	})
+
+	t.Run("empty after deleting from a multi-level map", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(store, 2)
+		require.NoError(t, err)
+
+		v := abi.NewTokenAmount(1)
+		for i := uint64(0); i < 100; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		m, err = adt.AsMap(store, tutil.MustRoot(t, m), 2)
+		require.NoError(t, err)
+		assert.False(t, m.IsEmpty())
+
+		for i := uint64(0); i < 100; i++ {
+			require.NoError(t, m.Delete(abi.UIntKey(i)))
+		}
+		assert.True(t, m.IsEmpty())
+	})
+}
+
+func TestMapCount(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+
+	t.Run("empty map", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		count, err := m.Count()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), count)
+	})
+
+	t.Run("single entry", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1)
+		require.NoError(t, m.Put(abi.UIntKey(1), &v))
+
+		count, err := m.Count()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), count)
+	})
+
+	t.Run("multiple levels", func(t *testing.T) {
+		// A small bitwidth forces the HAMT to grow several levels deep.
+		m, err := adt.MakeEmptyMap(store, 2)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1)
+		for i := uint64(0); i < 1000; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		m, err = adt.AsMap(store, tutil.MustRoot(t, m), 2)
+		require.NoError(t, err)
+
+		count, err := m.Count()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1000), count)
+	})
+}
+
+func TestMapCollectKeys(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	keys, err := m.CollectKeys()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	v := abi.NewTokenAmount(1)
+	var expected []string
+	for i := uint64(0); i < 20; i++ {
+		k := abi.UIntKey(i)
+		require.NoError(t, m.Put(k, &v))
+		expected = append(expected, k.Key())
+	}
+
+	keys, err = m.CollectKeys()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, keys)
+}
+
+func TestMapPutIfAbsent(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	v1 := abi.NewTokenAmount(1)
+	written, err := m.PutIfAbsent(abi.UIntKey(1), &v1)
+	require.NoError(t, err)
+	assert.True(t, written)
+	root := tutil.MustRoot(t, m)
+
+	// A second put for the same key is rejected, leaving the value and root unchanged.
+	v2 := abi.NewTokenAmount(2)
+	written, err = m.PutIfAbsent(abi.UIntKey(1), &v2)
+	require.NoError(t, err)
+	assert.False(t, written)
+	assert.Equal(t, root, tutil.MustRoot(t, m))
+
+	// A rejected put leaves a loaded map without pending changes.
+	m, err = adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	written, err = m.PutIfAbsent(abi.UIntKey(1), &v2)
+	require.NoError(t, err)
+	assert.False(t, written)
+	require.NoError(t, m.ForEachPrefetched(nil, func(string) error { return nil }))
+
+	var out abi.TokenAmount
+	found, err := m.Get(abi.UIntKey(1), &out)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, v1, out)
+}
+
+func TestMapTryDelete(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	v := abi.NewTokenAmount(1)
+	require.NoError(t, m.Put(abi.UIntKey(1), &v))
+	root := tutil.MustRoot(t, m)
+
+	// Deleting an absent key is a no-op.
+	found, err := m.TryDelete(abi.UIntKey(2))
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, root, tutil.MustRoot(t, m))
+
+	// Nor does it leave a loaded map with pending changes.
+	m, err = adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	found, err = m.TryDelete(abi.UIntKey(2))
+	require.NoError(t, err)
+	assert.False(t, found)
+	require.Error(t, m.Delete(abi.UIntKey(2)))
+	require.NoError(t, m.ForEachPrefetched(nil, func(string) error { return nil }))
+
+	found, err = m.TryDelete(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.NotEqual(t, root, tutil.MustRoot(t, m))
+
+	found, err = m.Has(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Strict delete of the now absent key fails.
+	assert.Error(t, m.Delete(abi.UIntKey(1)))
+}
+
+func TestMapPutBatch(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	batched, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	looped, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	var entries []adt.MapEntry
+	for i := uint64(0); i < 100; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		entries = append(entries, adt.MapEntry{Key: abi.UIntKey(i), Value: &v})
+		require.NoError(t, looped.Put(abi.UIntKey(i), &v))
+	}
+	// A repeated key takes the last value.
+	last := abi.NewTokenAmount(1000)
+	entries = append(entries, adt.MapEntry{Key: abi.UIntKey(0), Value: &last})
+	require.NoError(t, looped.Put(abi.UIntKey(0), &last))
+
+	require.NoError(t, batched.PutBatch(entries))
+	assert.Equal(t, tutil.MustRoot(t, looped), tutil.MustRoot(t, batched))
+}
+
+func BenchmarkMapPutFlushEach(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	v := abi.NewTokenAmount(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(b, err)
+		for j := uint64(0); j < 1000; j++ {
+			require.NoError(b, m.Put(abi.UIntKey(j), &v))
+			_, err = m.Root()
+			require.NoError(b, err)
+		}
+	}
+}
+
+func BenchmarkMapPutBatch(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	v := abi.NewTokenAmount(1)
+	entries := make([]adt.MapEntry, 1000)
+	for j := range entries {
+		entries[j] = adt.MapEntry{Key: abi.UIntKey(uint64(j)), Value: &v}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(b, err)
+		require.NoError(b, m.PutBatch(entries))
+		_, err = m.Root()
+		require.NoError(b, err)
+	}
+}
+
+// Re-puts every entry of a populated map with its existing value, flushing the root after each write,
+// as an actor does before saving updated state. `put` returns whether it wrote.
+func benchmarkMapRePut(b *testing.B, put func(m *adt.Map, k abi.Keyer, v cbor.Marshaler) (bool, error)) {
+	store := ipld.NewADTStore(context.Background())
+	v := abi.NewTokenAmount(1)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(b, err)
+	for j := uint64(0); j < 1000; j++ {
+		require.NoError(b, m.Put(abi.UIntKey(j), &v))
+	}
+	_, err = m.Root()
+	require.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := uint64(0); j < 1000; j++ {
+			written, err := put(m, abi.UIntKey(j), &v)
+			require.NoError(b, err)
+			if written {
+				_, err = m.Root()
+				require.NoError(b, err)
+			}
+		}
+	}
+}
+
+func BenchmarkMapRePutFlushEach(b *testing.B) {
+	benchmarkMapRePut(b, func(m *adt.Map, k abi.Keyer, v cbor.Marshaler) (bool, error) {
+		return true, m.Put(k, v)
+	})
+}
+
+func BenchmarkMapPutIfChanged(b *testing.B) {
+	benchmarkMapRePut(b, func(m *adt.Map, k abi.Keyer, v cbor.Marshaler) (bool, error) {
+		return m.PutIfChanged(k, v)
+	})
+}
+
+func TestMapDeleteBatch(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 10; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	deleted, err := m.DeleteBatch([]abi.Keyer{abi.UIntKey(1), abi.UIntKey(20), abi.UIntKey(3), abi.UIntKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []abi.Keyer{abi.UIntKey(1), abi.UIntKey(3)}, deleted)
+
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8), count)
+	for _, k := range deleted {
+		found, err := m.Has(k)
+		require.NoError(t, err)
+		assert.False(t, found)
+	}
+}
+
+func TestMapMerge(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	build := func(entries map[uint64]int64) *adt.Map {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for k, v := range entries {
+			v := abi.NewTokenAmount(v)
+			require.NoError(t, m.Put(abi.UIntKey(k), &v))
+		}
+		return m
+	}
+	get := func(m *adt.Map, k uint64) abi.TokenAmount {
+		var out abi.TokenAmount
+		found, err := m.Get(abi.UIntKey(k), &out)
+		require.NoError(t, err)
+		require.True(t, found)
+		return out
+	}
+
+	t.Run("overwrites without conflict handler", func(t *testing.T) {
+		m := build(map[uint64]int64{1: 1, 2: 2})
+		other := build(map[uint64]int64{2: 20, 3: 30})
+		otherRoot := tutil.MustRoot(t, other)
+
+		require.NoError(t, m.Merge(other, nil))
+		assert.Equal(t, tutil.MustRoot(t, build(map[uint64]int64{1: 1, 2: 20, 3: 30})), tutil.MustRoot(t, m))
+		// The other map is unchanged.
+		assert.Equal(t, otherRoot, tutil.MustRoot(t, other))
+	})
+
+	t.Run("resolves conflicts with handler", func(t *testing.T) {
+		m := build(map[uint64]int64{1: 1, 2: 2})
+		other := build(map[uint64]int64{2: 20, 3: 30})
+
+		var conflicts []string
+		require.NoError(t, m.Merge(other, func(key string, existing, incoming *cbg.Deferred) (cbor.Marshaler, error) {
+			conflicts = append(conflicts, key)
+			var a, b abi.TokenAmount
+			require.NoError(t, a.UnmarshalCBOR(bytes.NewReader(existing.Raw)))
+			require.NoError(t, b.UnmarshalCBOR(bytes.NewReader(incoming.Raw)))
+			sum := big.Add(a, b)
+			return &sum, nil
+		}))
+		assert.Equal(t, []string{abi.UIntKey(2).Key()}, conflicts)
+		assert.Equal(t, abi.NewTokenAmount(1), get(m, 1))
+		assert.Equal(t, abi.NewTokenAmount(22), get(m, 2))
+		assert.Equal(t, abi.NewTokenAmount(30), get(m, 3))
+	})
+
+	t.Run("handler error aborts merge", func(t *testing.T) {
+		m := build(map[uint64]int64{1: 1})
+		other := build(map[uint64]int64{1: 10})
+		err := m.Merge(other, func(key string, existing, incoming *cbg.Deferred) (cbor.Marshaler, error) {
+			return nil, xerrors.New("conflict")
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestMapEquals(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	build := func(bitwidth int, keys ...uint64) *adt.Map {
+		m, err := adt.MakeEmptyMap(store, bitwidth)
+		require.NoError(t, err)
+		for _, k := range keys {
+			v := abi.NewTokenAmount(int64(k))
+			require.NoError(t, m.Put(abi.UIntKey(k), &v))
+		}
+		return m
+	}
+	equals := func(a, b *adt.Map, eq func(a, b *cbg.Deferred) bool) bool {
+		equal, err := a.Equals(b, eq)
+		require.NoError(t, err)
+		return equal
+	}
+
+	t.Run("same entries in different insertion order", func(t *testing.T) {
+		assert.True(t, equals(build(5, 1, 2, 3, 4, 5), build(5, 5, 4, 3, 2, 1), nil))
+	})
+
+	t.Run("same entries with different layout", func(t *testing.T) {
+		a := build(2, 1, 2, 3, 4, 5, 6, 7, 8)
+		b := build(8, 1, 2, 3, 4, 5, 6, 7, 8)
+		assert.NotEqual(t, tutil.MustRoot(t, a), tutil.MustRoot(t, b))
+		assert.True(t, equals(a, b, nil))
+		assert.True(t, equals(b, a, nil))
+	})
+
+	t.Run("different keys", func(t *testing.T) {
+		assert.False(t, equals(build(5, 1, 2, 3), build(5, 1, 2), nil))
+		assert.False(t, equals(build(5, 1, 2), build(5, 1, 2, 3), nil))
+		assert.False(t, equals(build(5, 1, 2), build(5, 1, 3), nil))
+	})
+
+	t.Run("custom value equality", func(t *testing.T) {
+		a := build(5, 1, 2)
+		b := build(5, 1)
+		v := abi.NewTokenAmount(200)
+		require.NoError(t, b.Put(abi.UIntKey(2), &v))
+		assert.False(t, equals(a, b, nil))
+		assert.True(t, equals(a, b, func(a, b *cbg.Deferred) bool { return true }))
+	})
+
+	t.Run("pending changes are compared without writing", func(t *testing.T) {
+		mem := adt.NewMemStore()
+		m, err := adt.MakeEmptyMap(mem, 5)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1)
+		for i := uint64(0); i < 100; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		root := tutil.MustRoot(t, m)
+
+		// Both maps start from the same root, so differ only by pending changes.
+		readOnly := adt.NewReadOnlyStore(mem)
+		a, err := adt.AsMap(readOnly, root, 5)
+		require.NoError(t, err)
+		b, err := adt.AsMap(readOnly, root, 5)
+		require.NoError(t, err)
+		assert.True(t, equals(a, b, nil))
+
+		blocks := mem.Len()
+		require.NoError(t, b.Delete(abi.UIntKey(7)))
+		assert.False(t, equals(a, b, nil))
+		require.NoError(t, a.Delete(abi.UIntKey(7)))
+		assert.True(t, equals(a, b, nil))
+		assert.Equal(t, blocks, mem.Len())
+	})
+}
+
+func TestMapCopy(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, 2)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 50; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	// Leave some modifications unflushed so the copy must duplicate cached nodes.
+	root := tutil.MustRoot(t, m)
+	require.NoError(t, m.Put(abi.UIntKey(100), &v))
+
+	cp := m.Copy()
+	require.NoError(t, cp.Put(abi.UIntKey(200), &v))
+	require.NoError(t, cp.Delete(abi.UIntKey(0)))
+
+	found, err := m.Has(abi.UIntKey(200))
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = m.Has(abi.UIntKey(0))
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	// Reverting the original's unflushed change restores its root, unaffected by the copy.
+	require.NoError(t, m.Delete(abi.UIntKey(100)))
+	assert.Equal(t, root, tutil.MustRoot(t, m))
+
+	count, err := cp.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(51), count)
+}
+
+func TestMapForEachSorted(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	for _, k := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		v := cbg.CborCid(tutil.MakeCID(k, nil))
+		require.NoError(t, m.Put(strKey(k), &v))
+	}
+
+	var keys []string
+	var out cbg.CborCid
+	require.NoError(t, m.ForEachSorted(&out, func(key string) error {
+		assert.Equal(t, tutil.MakeCID(key, nil), cid.Cid(out))
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "delta", "echo"}, keys)
+}
+
+type strKey string
+
+func (k strKey) Key() string {
+	return string(k)
+}
+
+func TestMapForEachStopIteration(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 10; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	t.Run("stop early", func(t *testing.T) {
+		visited := 0
+		require.NoError(t, m.ForEach(nil, func(key string) error {
+			visited++
+			if visited == 3 {
+				return adt.StopIteration
+			}
+			return nil
+		}))
+		assert.Equal(t, 3, visited)
+	})
+
+	t.Run("stop on last element", func(t *testing.T) {
+		visited := 0
+		require.NoError(t, m.ForEach(nil, func(key string) error {
+			visited++
+			if visited == 10 {
+				return adt.StopIteration
+			}
+			return nil
+		}))
+		assert.Equal(t, 10, visited)
+	})
+
+	t.Run("stop sorted iteration", func(t *testing.T) {
+		visited := 0
+		require.NoError(t, m.ForEachSorted(nil, func(key string) error {
+			visited++
+			return adt.StopIteration
+		}))
+		assert.Equal(t, 1, visited)
+	})
+
+	t.Run("other errors propagate", func(t *testing.T) {
+		expected := xerrors.New("boom")
+		err := m.ForEach(nil, func(key string) error {
+			return expected
+		})
+		assert.Equal(t, expected, err)
+	})
+}
+
+func TestMapBitwidth(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	v := abi.NewTokenAmount(1)
+
+	roots := map[int]cid.Cid{}
+	for _, bitwidth := range []int{1, 3, 5, 8} {
+		m, err := adt.MakeEmptyMap(store, bitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 200; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		roots[bitwidth] = tutil.MustRoot(t, m)
+
+		// Reloading with the same bitwidth finds every entry.
+		m, err = adt.AsMap(store, roots[bitwidth], bitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 200; i++ {
+			found, err := m.Has(abi.UIntKey(i))
+			require.NoError(t, err)
+			require.True(t, found)
+		}
+	}
+	// Different bitwidths produce different tree layouts for the same content.
+	assert.NotEqual(t, roots[3], roots[5])
+}
+
+func BenchmarkMapGetByBitwidth(b *testing.B) {
+	for _, bitwidth := range []int{2, 5, 8} {
+		b.Run(fmt.Sprintf("bitwidth-%d", bitwidth), func(b *testing.B) {
+			bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+			store := adt.WrapBlockStore(context.Background(), bs)
+			m, err := adt.MakeEmptyMap(store, bitwidth)
+			require.NoError(b, err)
+			v := abi.NewTokenAmount(1)
+			for i := uint64(0); i < 100_000; i++ {
+				require.NoError(b, m.Put(abi.UIntKey(i), &v))
+			}
+			root, err := m.Root()
+			require.NoError(b, err)
+
+			reads := bs.ReadCount()
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m, err := adt.AsMap(store, root, bitwidth)
+				require.NoError(b, err)
+				found, err := m.Has(abi.UIntKey(uint64(i % 100_000)))
+				require.NoError(b, err)
+				require.True(b, found)
+			}
+			b.ReportMetric(float64(bs.ReadCount()-reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+func TestStoreEmptyMap(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+
+	root, err := adt.StoreEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	// The empty root is the same as that of a newly made map.
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	assert.Equal(t, root, tutil.MustRoot(t, m))
+
+	// The root loads back as an empty, iterable map.
+	m, err = adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	assert.True(t, m.IsEmpty())
+	require.NoError(t, m.ForEach(nil, func(key string) error {
+		t.Fatalf("unexpected key %v", key)
+		return nil
+	}))
+}
+
+// Iterating with a nil output parameter visits keys without decoding values.
+func BenchmarkMapForEach(b *testing.B) {
+	store := ipld.NewADTStore(context.Background())
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(b, err)
+	v := abi.NewTokenAmount(1_000_000_000)
+	for i := uint64(0); i < 10_000; i++ {
+		require.NoError(b, m.Put(abi.UIntKey(i), &v))
+	}
+	root, err := m.Root()
+	require.NoError(b, err)
+	m, err = adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+	require.NoError(b, err)
+
+	b.Run("keys only", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			require.NoError(b, m.ForEach(nil, func(key string) error {
+				return nil
+			}))
+		}
+	})
+	b.Run("decode values", func(b *testing.B) {
+		b.ReportAllocs()
+		var out abi.TokenAmount
+		for i := 0; i < b.N; i++ {
+			require.NoError(b, m.ForEach(&out, func(key string) error {
+				return nil
+			}))
+		}
+	})
+	// Compare with "decode values", which reuses a single target.
+	b.Run("decode fresh values", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			require.NoError(b, m.ForEachValue(func() cbor.Unmarshaler {
+				return new(abi.TokenAmount)
+			}, func(key string, value cbor.Unmarshaler) error {
+				return nil
+			}))
+		}
+	})
+}
+
+func TestMapBlockWrites(t *testing.T) {
+	bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+	store := adt.WrapBlockStore(context.Background(), bs)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+
+	// Puts write nothing until the root is requested.
+	for i := uint64(0); i < 3; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	assert.Equal(t, uint64(0), bs.WriteCount())
+
+	// A single-level map is written as exactly one block.
+	tutil.MustRoot(t, m)
+	assert.Equal(t, uint64(1), bs.WriteCount())
+
+	for i := uint64(0); i < 1000; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	tutil.MustRoot(t, m)
+
+	// Without changes, only the root node is rewritten.
+	writes := bs.WriteCount()
+	tutil.MustRoot(t, m)
+	assert.Equal(t, writes+1, bs.WriteCount())
+
+	// A single put to a multi-level map writes only the nodes on the path to the key.
+	writes = bs.WriteCount()
+	v = abi.NewTokenAmount(2)
+	require.NoError(t, m.Put(abi.UIntKey(500), &v))
+	tutil.MustRoot(t, m)
+	assert.Less(t, bs.WriteCount()-writes, uint64(5))
+	assert.Greater(t, bs.WriteCount()-writes, uint64(1))
+}
+
+func TestLoadOrCreateMap(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+
+	t.Run("creates empty map for undefined root", func(t *testing.T) {
+		m, err := adt.LoadOrCreateMap(store, cid.Undef, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.True(t, m.IsEmpty())
+
+		empty, err := adt.StoreEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		assert.Equal(t, empty, tutil.MustRoot(t, m))
+	})
+
+	t.Run("loads existing root", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1)
+		require.NoError(t, m.Put(abi.UIntKey(1), &v))
+		root := tutil.MustRoot(t, m)
+
+		m, err = adt.LoadOrCreateMap(store, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		found, err := m.Has(abi.UIntKey(1))
+		require.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("fails for root that cannot be loaded", func(t *testing.T) {
+		store := ipld.NewADTStore(context.Background())
+		_, err := adt.LoadOrCreateMap(store, tutil.MakeCID("missing", nil), builtin.DefaultHamtBitwidth)
+		assert.Error(t, err)
+
+		v := abi.NewTokenAmount(1)
+		notMap, err := store.Put(context.Background(), &v)
+		require.NoError(t, err)
+		_, err = adt.LoadOrCreateMap(store, notMap, builtin.DefaultHamtBitwidth)
+		assert.Error(t, err)
+	})
+}
+
+func TestMapForEachWithContext(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 10; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	t.Run("visits all entries", func(t *testing.T) {
+		visited := 0
+		var out abi.TokenAmount
+		require.NoError(t, m.ForEachWithContext(context.Background(), &out, func(key string) error {
+			assert.Equal(t, v, out)
+			visited++
+			return nil
+		}))
+		assert.Equal(t, 10, visited)
+	})
+
+	t.Run("cancelled mid-iteration", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		visited := 0
+		err := m.ForEachWithContext(ctx, nil, func(key string) error {
+			visited++
+			if visited == 4 {
+				cancel()
+			}
+			return nil
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 4, visited)
+	})
+}
+
+func TestMapValidate(t *testing.T) {
+	ctx := context.Background()
+	store := ipld.NewADTStore(ctx)
+	v := abi.NewTokenAmount(1)
+	buildRoot := func(bitwidth int) cid.Cid {
+		m, err := adt.MakeEmptyMap(store, bitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 100; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		return tutil.MustRoot(t, m)
+	}
+
+	t.Run("valid maps", func(t *testing.T) {
+		for _, bitwidth := range []int{2, 5, 8} {
+			m, err := adt.AsMap(store, buildRoot(bitwidth), bitwidth)
+			require.NoError(t, err)
+			assert.NoError(t, m.Validate())
+		}
+		m, err := adt.MakeEmptyMap(store, 5)
+		require.NoError(t, err)
+		assert.NoError(t, m.Validate())
+	})
+
+	t.Run("pending changes on a read-only store", func(t *testing.T) {
+		m, err := adt.AsMap(adt.NewReadOnlyStore(store), buildRoot(2), 2)
+		require.NoError(t, err)
+		for i := uint64(50); i < 150; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		require.NoError(t, m.Delete(abi.UIntKey(0)))
+		assert.NoError(t, m.Validate())
+	})
+
+	t.Run("wrong bitwidth", func(t *testing.T) {
+		m, err := adt.AsMap(store, buildRoot(3), 5)
+		require.NoError(t, err)
+		assert.Error(t, m.Validate())
+	})
+
+	t.Run("corrupt child link", func(t *testing.T) {
+		var node hamt.Node
+		require.NoError(t, store.Get(ctx, buildRoot(2), &node))
+		notNode, err := store.Put(ctx, &v)
+		require.NoError(t, err)
+		corrupted := false
+		for _, p := range node.Pointers {
+			if p.Link.Defined() {
+				p.Link = notNode
+				corrupted = true
+				break
+			}
+		}
+		require.True(t, corrupted)
+		root, err := store.Put(ctx, &node)
+		require.NoError(t, err)
+
+		m, err := adt.AsMap(store, root, 2)
+		require.NoError(t, err)
+		assert.Error(t, m.Validate())
+	})
+
+	t.Run("misplaced key", func(t *testing.T) {
+		var node hamt.Node
+		require.NoError(t, store.Get(ctx, buildRoot(5), &node))
+		for _, p := range node.Pointers {
+			if len(p.KVs) > 0 {
+				p.KVs[0].Key = []byte("not here")
+				break
+			}
+		}
+		root, err := store.Put(ctx, &node)
+		require.NoError(t, err)
+
+		m, err := adt.AsMap(store, root, 5)
+		require.NoError(t, err)
+		err = m.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not located by its hash")
+	})
+}
+
+func TestMapStats(t *testing.T) {
+	v := abi.NewTokenAmount(1)
+
+	// Computes stats of a map with pending changes, checking that doing so writes nothing and that they match
+	// both the blocks written by a subsequent flush and the stats of the flushed map.
+	pendingStats := func(t *testing.T, bs *ipld.MetricsBlockStore, m *adt.Map) adt.MapStats {
+		stats, err := m.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), bs.WriteCount())
+
+		tutil.MustRoot(t, m)
+		assert.Equal(t, bs.WriteCount(), stats.NodeCount)
+		assert.Equal(t, bs.WriteSize(), stats.ByteSize)
+		flushed, err := m.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, stats, flushed)
+		return stats
+	}
+
+	t.Run("empty map", func(t *testing.T) {
+		bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+		m, err := adt.MakeEmptyMap(adt.WrapBlockStore(context.Background(), bs), builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		stats := pendingStats(t, bs, m)
+		assert.Equal(t, adt.MapStats{MaxDepth: 1, NodeCount: 1, EntryCount: 0, ByteSize: bs.WriteSize()}, stats)
+	})
+
+	t.Run("single level", func(t *testing.T) {
+		bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+		m, err := adt.MakeEmptyMap(adt.WrapBlockStore(context.Background(), bs), builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 3; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		stats := pendingStats(t, bs, m)
+		assert.Equal(t, adt.MapStats{MaxDepth: 1, NodeCount: 1, EntryCount: 3, ByteSize: bs.WriteSize()}, stats)
+	})
+
+	t.Run("multiple levels", func(t *testing.T) {
+		bs := ipld.NewMetricsBlockStore(ipld.NewBlockStoreInMemory())
+		m, err := adt.MakeEmptyMap(adt.WrapBlockStore(context.Background(), bs), 2)
+		require.NoError(t, err)
+		for i := uint64(0); i < 1000; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		stats := pendingStats(t, bs, m)
+		assert.Equal(t, uint64(1000), stats.EntryCount)
+		assert.Greater(t, stats.MaxDepth, uint64(3))
+	})
+
+	t.Run("modified after loading on a read-only store", func(t *testing.T) {
+		store := adt.NewMemStore()
+		m, err := adt.MakeEmptyMap(store, 2)
+		require.NoError(t, err)
+		for i := uint64(0); i < 1000; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		loaded, err := adt.AsMap(adt.NewReadOnlyStore(store), tutil.MustRoot(t, m), 2)
+		require.NoError(t, err)
+		for i := uint64(0); i < 500; i++ {
+			require.NoError(t, loaded.Delete(abi.UIntKey(i)))
+			require.NoError(t, m.Delete(abi.UIntKey(i)))
+		}
+		tutil.MustRoot(t, m)
+
+		stats, err := loaded.Stats()
+		require.NoError(t, err)
+		expected, err := m.Stats()
+		require.NoError(t, err)
+		assert.Equal(t, expected, stats)
+		assert.Equal(t, uint64(500), stats.EntryCount)
+	})
+}
+
+func TestMapDeleteNotFound(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	err = m.Delete(abi.UIntKey(1))
+	require.Error(t, err)
+	assert.True(t, xerrors.Is(err, adt.ErrNotFound))
+}
+
+func TestMapForEachValue(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 5; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	// Values are retained across iterations without being overwritten.
+	values := map[uint64]*abi.TokenAmount{}
+	require.NoError(t, m.ForEachValue(func() cbor.Unmarshaler {
+		return new(abi.TokenAmount)
+	}, func(key string, value cbor.Unmarshaler) error {
+		k, err := abi.ParseUIntKey(key)
+		require.NoError(t, err)
+		values[k] = value.(*abi.TokenAmount)
+		return nil
+	}))
+	require.Len(t, values, 5)
+	for i := uint64(0); i < 5; i++ {
+		assert.Equal(t, abi.NewTokenAmount(int64(i)), *values[i])
+	}
+}
+
+func TestMapGetPutRaw(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	src, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	dst, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	v := abi.NewTokenAmount(1234)
+	require.NoError(t, src.Put(abi.UIntKey(1), &v))
+
+	_, found, err := src.GetRaw(abi.UIntKey(2))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	raw, found, err := src.GetRaw(abi.UIntKey(1))
+	require.NoError(t, err)
+	require.True(t, found)
+	var buf bytes.Buffer
+	require.NoError(t, v.MarshalCBOR(&buf))
+	assert.Equal(t, buf.Bytes(), raw)
+
+	// Copying the raw value produces an identical map.
+	require.NoError(t, dst.PutRaw(abi.UIntKey(1), raw))
+	assert.Equal(t, tutil.MustRoot(t, src), tutil.MustRoot(t, dst))
+
+	// Malformed values are rejected.
+	assert.Error(t, dst.PutRaw(abi.UIntKey(2), nil))
+	assert.Error(t, dst.PutRaw(abi.UIntKey(2), raw[:len(raw)-1]))
+	assert.Error(t, dst.PutRaw(abi.UIntKey(2), append(raw, raw...)))
+	found, err = dst.Has(abi.UIntKey(2))
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMapPutIfChanged(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	v1 := abi.NewTokenAmount(1)
+	written, err := m.PutIfChanged(abi.UIntKey(1), &v1)
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	same := abi.NewTokenAmount(1)
+	written, err = m.PutIfChanged(abi.UIntKey(1), &same)
+	require.NoError(t, err)
+	assert.False(t, written)
+
+	v2 := abi.NewTokenAmount(2)
+	written, err = m.PutIfChanged(abi.UIntKey(1), &v2)
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	var out abi.TokenAmount
+	found, err := m.Get(abi.UIntKey(1), &out)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, v2, out)
+}
+
+func TestMapRekey(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	// Keys encoded as decimal strings, to be migrated to varint keys.
+	for i := uint64(0); i < 50; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(strKey(fmt.Sprintf("%d", i)), &v))
+	}
+	original := tutil.MustRoot(t, m)
+
+	parseDecimal := func(k string) (abi.Keyer, error) {
+		var i uint64
+		if _, err := fmt.Sscanf(k, "%d", &i); err != nil {
+			return nil, err
+		}
+		return abi.UIntKey(i), nil
+	}
+	rekeyed, err := m.Rekey(parseDecimal)
+	require.NoError(t, err)
+	assert.Equal(t, original, tutil.MustRoot(t, m))
+
+	expected, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 50; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, expected.Put(abi.UIntKey(i), &v))
+	}
+	assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, rekeyed))
+
+	// Colliding keys are rejected.
+	v := abi.NewTokenAmount(1)
+	require.NoError(t, m.Put(strKey("007"), &v))
+	_, err = m.Rekey(parseDecimal)
+	assert.Error(t, err)
+
+	// Errors from the key function are propagated.
+	failure := xerrors.New("failure")
+	_, err = m.Rekey(func(string) (abi.Keyer, error) { return nil, failure })
+	assert.True(t, xerrors.Is(err, failure))
+}
+
+func TestMapMapValues(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	expected, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 50; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		// Values are migrated from token amounts to plain integers.
+		w := cbg.CborInt(i)
+		require.NoError(t, expected.Put(abi.UIntKey(i), &w))
+	}
+	original := tutil.MustRoot(t, m)
+
+	upgraded, err := m.MapValues(func(key string, raw []byte) (cbor.Marshaler, error) {
+		var v abi.TokenAmount
+		if err := v.UnmarshalCBOR(bytes.NewReader(raw)); err != nil {
+			return nil, err
+		}
+		w := cbg.CborInt(v.Int64())
+		return &w, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, upgraded))
+	assert.Equal(t, original, tutil.MustRoot(t, m))
+
+	failure := xerrors.New("failure")
+	_, err = m.MapValues(func(string, []byte) (cbor.Marshaler, error) { return nil, failure })
+	assert.True(t, xerrors.Is(err, failure))
+}
+
+func TestMapToGoMap(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	empty, err := m.ToGoMap(func() cbor.Unmarshaler { return new(abi.TokenAmount) })
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	expected := map[string]cbor.Unmarshaler{}
+	for i := uint64(0); i < 20; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		expected[abi.UIntKey(i).Key()] = &v
+	}
+	m, err = adt.AsMap(store, tutil.MustRoot(t, m), builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	dump, err := m.ToGoMap(func() cbor.Unmarshaler { return new(abi.TokenAmount) })
+	require.NoError(t, err)
+	assert.Equal(t, expected, dump)
+}
+
+func TestMapForEachParallel(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	const count = 2000
+	for i := uint64(0); i < count; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	newValue := func() cbor.Unmarshaler { return new(abi.TokenAmount) }
+
+	t.Run("pending changes", func(t *testing.T) {
+		err := m.ForEachParallel(4, newValue, func(key string, value cbor.Unmarshaler) error {
+			return nil
+		})
+		assert.Error(t, err)
+	})
+
+	m, err = adt.AsMap(store, tutil.MustRoot(t, m), builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	for _, workers := range []int{1, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var lk sync.Mutex
+			visits := map[uint64]int{}
+			require.NoError(t, m.ForEachParallel(workers, newValue, func(key string, value cbor.Unmarshaler) error {
+				k, err := abi.ParseUIntKey(key)
+				if err != nil {
+					return err
+				}
+				if !value.(*abi.TokenAmount).Equals(abi.NewTokenAmount(int64(k))) {
+					return xerrors.Errorf("unexpected value %v for key %d", value, k)
+				}
+				lk.Lock()
+				defer lk.Unlock()
+				visits[k]++
+				return nil
+			}))
+			require.Len(t, visits, count)
+			for k, n := range visits {
+				assert.Equal(t, 1, n, "key %d", k)
+			}
+		})
+	}
+
+	t.Run("halts on error", func(t *testing.T) {
+		expected := xerrors.New("fail")
+		err := m.ForEachParallel(4, newValue, func(key string, value cbor.Unmarshaler) error {
+			return expected
+		})
+		assert.Equal(t, expected, err)
+
+		var visited int32
+		require.NoError(t, m.ForEachParallel(4, newValue, func(key string, value cbor.Unmarshaler) error {
+			atomic.AddInt32(&visited, 1)
+			return adt.StopIteration
+		}))
+		assert.Less(t, int(atomic.LoadInt32(&visited)), count)
+	})
+
+	t.Run("modified after loading", func(t *testing.T) {
+		m, err := adt.AsMap(store, tutil.MustRoot(t, m), builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 200; i++ {
+			v := abi.NewTokenAmount(int64(i) + count)
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		require.NoError(t, m.Delete(abi.UIntKey(0)))
+		visited := 0
+		assert.Error(t, m.ForEachParallel(4, newValue, func(key string, value cbor.Unmarshaler) error {
+			visited++
+			return nil
+		}))
+		assert.Equal(t, 0, visited)
+
+		tutil.MustRoot(t, m)
+		var lk sync.Mutex
+		seen := map[uint64]int64{}
+		require.NoError(t, m.ForEachParallel(4, newValue, func(key string, value cbor.Unmarshaler) error {
+			k, err := abi.ParseUIntKey(key)
+			if err != nil {
+				return err
+			}
+			lk.Lock()
+			defer lk.Unlock()
+			seen[k] = value.(*abi.TokenAmount).Int64()
+			return nil
+		}))
+		require.Len(t, seen, count-1)
+		assert.NotContains(t, seen, uint64(0))
+		for k := uint64(1); k < 200; k++ {
+			assert.Equal(t, int64(k)+count, seen[k])
+		}
+	})
+
+	t.Run("invalid worker count", func(t *testing.T) {
+		assert.Error(t, m.ForEachParallel(0, newValue, func(key string, value cbor.Unmarshaler) error {
+			return nil
+		}))
+	})
+}
+
+func BenchmarkMapForEachParallel(b *testing.B) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(b, err)
+	for i := uint64(0); i < 10_000; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(b, m.Put(abi.UIntKey(i), &v))
+	}
+	root, err := m.Root()
+	require.NoError(b, err)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m, err := adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+				require.NoError(b, err)
+				require.NoError(b, m.ForEachParallel(workers, func() cbor.Unmarshaler {
+					return new(abi.TokenAmount)
+				}, func(key string, value cbor.Unmarshaler) error {
+					return nil
+				}))
+			}
+		})
+	}
+}
+
+func TestMapForEachReusesTarget(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 10; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	// Each value overwrites the last in the same target.
+	var out abi.TokenAmount
+	seen := map[uint64]int64{}
+	require.NoError(t, m.ForEach(&out, func(key string) error {
+		k, err := abi.ParseUIntKey(key)
+		require.NoError(t, err)
+		seen[k] = out.Int64()
+		return nil
+	}))
+	require.Len(t, seen, 10)
+	for k, v := range seen {
+		assert.Equal(t, int64(k), v)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		require.NoError(t, m.ForEach(&out, func(key string) error { return nil }))
+	})
+	freshAllocs := testing.AllocsPerRun(10, func() {
+		require.NoError(t, m.ForEachValue(func() cbor.Unmarshaler {
+			return new(abi.TokenAmount)
+		}, func(key string, value cbor.Unmarshaler) error { return nil }))
+	})
+	assert.Less(t, allocs, freshAllocs)
+}
+
+func TestMapForEachPrefetched(t *testing.T) {
+	mem := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(mem, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	const count = 2000
+	for i := uint64(0); i < count; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	root := tutil.MustRoot(t, m)
+
+	// Collects keys and values and the elapsed time of an iteration over the map loaded from a store.
+	iterate := func(s adt.Store, forEach func(m *adt.Map, out cbor.Unmarshaler, fn func(string) error) error) ([]string, time.Duration) {
+		m, err := adt.AsMap(s, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var keys []string
+		var out abi.TokenAmount
+		start := time.Now()
+		require.NoError(t, forEach(m, &out, func(key string) error {
+			k, err := abi.ParseUIntKey(key)
+			require.NoError(t, err)
+			require.Equal(t, int64(k), out.Int64())
+			keys = append(keys, key)
+			return nil
+		}))
+		return keys, time.Since(start)
+	}
+	sequential := func(m *adt.Map, out cbor.Unmarshaler, fn func(string) error) error {
+		return m.ForEach(out, fn)
+	}
+	prefetched := func(m *adt.Map, out cbor.Unmarshaler, fn func(string) error) error {
+		return m.ForEachPrefetched(out, fn)
+	}
+
+	expectedKeys, _ := iterate(mem, sequential)
+	require.Len(t, expectedKeys, count)
+
+	t.Run("batching store", func(t *testing.T) {
+		slow := &slowStore{Store: mem, latency: time.Millisecond}
+		_, sequentialTime := iterate(slow, sequential)
+		sequentialTrips := slow.roundTrips
+
+		slow.roundTrips = 0
+		keys, prefetchedTime := iterate(slowBatchStore{slow}, prefetched)
+		assert.Equal(t, expectedKeys, keys)
+		assert.Less(t, slow.roundTrips, sequentialTrips)
+		assert.Less(t, int64(prefetchedTime), int64(sequentialTime))
+	})
+
+	t.Run("non-batching store", func(t *testing.T) {
+		keys, _ := iterate(mem, prefetched)
+		assert.Equal(t, expectedKeys, keys)
+	})
+
+	t.Run("pending changes", func(t *testing.T) {
+		m, err := adt.MakeEmptyMap(mem, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < count; i++ {
+			v := abi.NewTokenAmount(int64(i))
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		assert.Error(t, m.ForEachPrefetched(nil, func(string) error { return nil }))
+	})
+
+	t.Run("modified after loading", func(t *testing.T) {
+		m, err := adt.AsMap(mem, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for i := uint64(0); i < 200; i++ {
+			v := abi.NewTokenAmount(int64(i) + count)
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		require.NoError(t, m.Delete(abi.UIntKey(0)))
+		assert.Error(t, m.ForEachPrefetched(nil, func(string) error { return nil }))
+
+		// ForEach over the batching store sees the pending changes rather than the stored nodes.
+		var out abi.TokenAmount
+		seen := map[uint64]int64{}
+		require.NoError(t, m.ForEach(&out, func(key string) error {
+			k, err := abi.ParseUIntKey(key)
+			require.NoError(t, err)
+			seen[k] = out.Int64()
+			return nil
+		}))
+		require.Len(t, seen, count-1)
+		assert.NotContains(t, seen, uint64(0))
+		for k := uint64(1); k < 200; k++ {
+			assert.Equal(t, int64(k)+count, seen[k])
+		}
+
+		tutil.MustRoot(t, m)
+		keys := 0
+		require.NoError(t, m.ForEachPrefetched(nil, func(string) error {
+			keys++
+			return nil
+		}))
+		assert.Equal(t, count-1, keys)
+	})
+
+	t.Run("stop iteration", func(t *testing.T) {
+		m, err := adt.AsMap(mem, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var keys []string
+		require.NoError(t, m.ForEachPrefetched(nil, func(key string) error {
+			keys = append(keys, key)
+			if len(keys) == 10 {
+				return adt.StopIteration
+			}
+			return nil
+		}))
+		assert.Equal(t, expectedKeys[:10], keys)
+	})
+}
+
+// A store adding a fixed latency to each round trip.
+type slowStore struct {
+	adt.Store
+	latency    time.Duration
+	roundTrips int
+}
+
+func (s *slowStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	s.roundTrips++
+	time.Sleep(s.latency)
+	return s.Store.Get(ctx, c, out)
+}
+
+// A slow store that serves a batch of blocks in one round trip.
+type slowBatchStore struct {
+	*slowStore
+}
+
+func (s slowBatchStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	s.roundTrips++
+	time.Sleep(s.latency)
+	for i, c := range cids {
+		if err := s.Store.Get(ctx, c, out[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMapCountMatching(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	var out abi.TokenAmount
+	even := func(string) bool { return out.Int64()%2 == 0 }
+	count, err := m.CountMatching(&out, even)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	for i := uint64(0); i < 25; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	count, err = m.CountMatching(&out, even)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(13), count)
+
+	// Matching on keys alone needs no decoding.
+	count, err = m.CountMatching(nil, func(key string) bool {
+		k, err := abi.ParseUIntKey(key)
+		require.NoError(t, err)
+		return k >= 20
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), count)
+}
+
+func TestMapFindFirst(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 25; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	t.Run("found", func(t *testing.T) {
+		var out abi.TokenAmount
+		visited := 0
+		key, found, err := m.FindFirst(&out, func(string) bool {
+			visited++
+			return out.Int64() == 17
+		})
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, abi.UIntKey(17).Key(), key)
+		assert.Equal(t, abi.NewTokenAmount(17), out)
+
+		// Iteration stops at the first match.
+		keys, err := m.CollectKeys()
+		require.NoError(t, err)
+		for i, k := range keys {
+			if k == key {
+				assert.Equal(t, i+1, visited)
+			}
+		}
+		key, found, err = m.FindFirst(nil, func(string) bool { return true })
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, keys[0], key)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var out abi.TokenAmount
+		visited := 0
+		key, found, err := m.FindFirst(&out, func(string) bool {
+			visited++
+			return out.Int64() > 100
+		})
+		require.NoError(t, err)
+		assert.False(t, found)
+		assert.Equal(t, "", key)
+		assert.Equal(t, 25, visited)
+	})
+}
+
+func TestMapFilter(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 30; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	before := tutil.MustRoot(t, m)
+
+	var out abi.TokenAmount
+	filtered, err := m.Filter(&out, func(string) bool { return out.Int64()%3 == 0 })
+	require.NoError(t, err)
+	assert.Equal(t, before, tutil.MustRoot(t, m))
+
+	// The filtered map is independent of its source and holds exactly the kept entries.
+	reloaded, err := adt.AsMap(store, tutil.MustRoot(t, filtered), builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	expected := map[string]cbor.Unmarshaler{}
+	for i := uint64(0); i < 30; i += 3 {
+		v := abi.NewTokenAmount(int64(i))
+		expected[abi.UIntKey(i).Key()] = &v
+	}
+	dump, err := reloaded.ToGoMap(func() cbor.Unmarshaler { return new(abi.TokenAmount) })
+	require.NoError(t, err)
+	assert.Equal(t, expected, dump)
+
+	none, err := m.Filter(nil, func(string) bool { return false })
+	require.NoError(t, err)
+	assert.True(t, none.IsEmpty())
+}
+
+func TestMapGetWithDefault(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(5)
+	require.NoError(t, m.Put(abi.UIntKey(1), &v))
+	def := abi.NewTokenAmount(-1)
+
+	t.Run("hit", func(t *testing.T) {
+		var out abi.TokenAmount
+		require.NoError(t, m.GetWithDefault(abi.UIntKey(1), &out, &def))
+		assert.Equal(t, abi.NewTokenAmount(5), out)
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		out := abi.NewTokenAmount(100)
+		require.NoError(t, m.GetWithDefault(abi.UIntKey(2), &out, &def))
+		assert.Equal(t, abi.NewTokenAmount(-1), out)
+		found, err := m.Has(abi.UIntKey(2))
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+}
+
+func TestMapModify(t *testing.T) {
+	mem := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(mem, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 100; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	root := tutil.MustRoot(t, m)
+
+	get := func(m *adt.Map, k uint64) (abi.TokenAmount, bool) {
+		var v abi.TokenAmount
+		found, err := m.Get(abi.UIntKey(k), &v)
+		require.NoError(t, err)
+		return v, found
+	}
+
+	t.Run("existing key", func(t *testing.T) {
+		store := adt.NewInstrumentedStore(mem)
+		m, err := adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		store.Reset()
+
+		var v abi.TokenAmount
+		require.NoError(t, m.Modify(abi.UIntKey(42), &v, func(found bool) (cbor.Marshaler, error) {
+			assert.True(t, found)
+			assert.Equal(t, abi.NewTokenAmount(42), v)
+			sum := big.Add(v, abi.NewTokenAmount(10))
+			return &sum, nil
+		}))
+		loads := store.Stats().Gets
+		value, found := get(m, 42)
+		assert.True(t, found)
+		assert.Equal(t, abi.NewTokenAmount(52), value)
+		// All the nodes on the path were loaded by the read, and none again by the write.
+		assert.Equal(t, loads, store.Stats().Gets)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		m, err := adt.AsMap(mem, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var v abi.TokenAmount
+		require.NoError(t, m.Modify(abi.UIntKey(1000), &v, func(found bool) (cbor.Marshaler, error) {
+			assert.False(t, found)
+			sum := abi.NewTokenAmount(7)
+			return &sum, nil
+		}))
+		value, found := get(m, 1000)
+		assert.True(t, found)
+		assert.Equal(t, abi.NewTokenAmount(7), value)
+	})
+
+	t.Run("mutation error", func(t *testing.T) {
+		m, err := adt.AsMap(mem, root, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		var v abi.TokenAmount
+		expected := xerrors.New("fail")
+		err = m.Modify(abi.UIntKey(1), &v, func(bool) (cbor.Marshaler, error) { return nil, expected })
+		assert.Equal(t, expected, err)
+		assert.Equal(t, root, tutil.MustRoot(t, m))
+	})
+}
+
+func TestMapIncrement(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	key := abi.UIntKey(1)
+	increment := func(delta int64) int64 {
+		total, err := m.Increment(key, delta)
+		require.NoError(t, err)
+		var stored cbg.CborInt
+		found, err := m.Get(key, &stored)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, total, int64(stored))
+		return total
+	}
+
+	assert.Equal(t, int64(5), increment(5))
+	assert.Equal(t, int64(8), increment(3))
+	assert.Equal(t, int64(-2), increment(-10))
+	assert.Equal(t, int64(-2), increment(0))
+	assert.Equal(t, int64(1), increment(3))
+
+	// Keys are independent.
+	other, err := m.Increment(abi.UIntKey(2), -4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-4), other)
+	assert.Equal(t, int64(1), increment(0))
+
+	t.Run("overflow", func(t *testing.T) {
+		_, err := m.Increment(key, math.MaxInt64)
+		assert.Error(t, err)
+		_, err = m.Increment(abi.UIntKey(2), math.MinInt64)
+		assert.Error(t, err)
+		assert.Equal(t, int64(1), increment(0))
+	})
+}
+
+func TestMapCollectGarbage(t *testing.T) {
+	t.Run("removes nodes orphaned by deletes", func(t *testing.T) {
+		store := adt.NewMemStore()
+		// An unrelated block, which must survive collection.
+		marker := abi.NewTokenAmount(-1)
+		markerCid, err := store.Put(context.Background(), &marker)
+		require.NoError(t, err)
+
+		m, err := adt.MakeEmptyMap(store, 3)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1)
+		for i := uint64(0); i < 500; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		before := tutil.MustRoot(t, m)
+		beforeStats, err := m.Stats()
+		require.NoError(t, err)
+		unrelated := store.Len() - int(beforeStats.NodeCount)
+
+		for i := uint64(0); i < 400; i++ {
+			require.NoError(t, m.Delete(abi.UIntKey(i)))
+		}
+		require.NoError(t, m.CollectGarbage(before))
+
+		// Only the current map's nodes, and blocks outside the previous map, remain.
+		afterStats, err := m.Stats()
+		require.NoError(t, err)
+		assert.Less(t, afterStats.NodeCount, beforeStats.NodeCount)
+		assert.Equal(t, unrelated+int(afterStats.NodeCount), store.Len())
+		has, err := store.Has(context.Background(), markerCid)
+		require.NoError(t, err)
+		assert.True(t, has)
+
+		reloaded, err := adt.AsMap(store, tutil.MustRoot(t, m), 3)
+		require.NoError(t, err)
+		require.NoError(t, reloaded.Validate())
+		count, err := reloaded.Count()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(100), count)
+	})
+
+	t.Run("unchanged map is a no-op", func(t *testing.T) {
+		store := adt.NewMemStore()
+		m, err := adt.MakeEmptyMap(store, 3)
+		require.NoError(t, err)
+		v := abi.NewTokenAmount(1)
+		for i := uint64(0); i < 100; i++ {
+			require.NoError(t, m.Put(abi.UIntKey(i), &v))
+		}
+		root := tutil.MustRoot(t, m)
+		blocks := store.Len()
+		require.NoError(t, m.CollectGarbage(root))
+		assert.Equal(t, blocks, store.Len())
+	})
+
+	t.Run("requires a delete store", func(t *testing.T) {
+		store := ipld.NewADTStore(context.Background())
+		m, err := adt.MakeEmptyMap(store, 3)
+		require.NoError(t, err)
+		err = m.CollectGarbage(tutil.MustRoot(t, m))
+		assert.Error(t, err)
+	})
+}
+
+func TestMapForEachBatchesReads(t *testing.T) {
+	mem := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(mem, 3)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	for i := uint64(0); i < 500; i++ {
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+	root := tutil.MustRoot(t, m)
+	collect := func(m *adt.Map) []string {
+		var keys []string
+		require.NoError(t, m.ForEach(nil, func(k string) error {
+			keys = append(keys, k)
+			return nil
+		}))
+		return keys
+	}
+	expected := collect(m)
+
+	store := &batchCountingStore{Store: plainStore{mem}}
+	loaded, err := adt.AsMap(store, root, 3)
+	require.NoError(t, err)
+	assert.Equal(t, expected, collect(loaded))
+	assert.Greater(t, store.batches, 0)
+
+	// A map with pending changes is traversed in memory.
+	store.batches = 0
+	require.NoError(t, loaded.Put(abi.UIntKey(1000), &v))
+	keys := collect(loaded)
+	assert.Len(t, keys, len(expected)+1)
+	assert.Equal(t, 0, store.batches)
+}
@@ -0,0 +1,122 @@
+package adt
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/cbor"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// MemStore is a Store holding serialized blocks in memory, appropriate for testing collections
+// without a runtime. Blocks are addressed with abi.CidBuilder, as they are by the runtime.
+// A MemStore is safe for concurrent use.
+type MemStore struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	blocks map[cid.Cid][]byte
+}
+
+var _ BatchStore = (*MemStore)(nil)
+var _ HasStore = (*MemStore)(nil)
+var _ DeleteStore = (*MemStore)(nil)
+
+// Creates a new, empty, in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		ctx:    context.Background(),
+		blocks: make(map[cid.Cid][]byte),
+	}
+}
+
+func (s *MemStore) Context() context.Context {
+	return s.ctx
+}
+
+// Get deserializes the block with CID `c` into `out`, which must be a cbor.Unmarshaler.
+// Returns an error wrapping ErrNotFound if there is no such block.
+func (s *MemStore) Get(_ context.Context, c cid.Cid, out interface{}) error {
+	um, ok := out.(cbor.Unmarshaler)
+	if !ok {
+		return xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", c, out)
+	}
+	s.mu.Lock()
+	data, found := s.blocks[c]
+	s.mu.Unlock()
+	if !found {
+		return xerrors.Errorf("block %v: %w", c, ErrNotFound)
+	}
+	return um.UnmarshalCBOR(bytes.NewReader(data))
+}
+
+func (s *MemStore) Has(_ context.Context, c cid.Cid) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.blocks[c]
+	return found, nil
+}
+
+// GetMany deserializes many blocks at once, holding the store's lock just once.
+func (s *MemStore) GetMany(_ context.Context, cids []cid.Cid, out []interface{}) error {
+	if len(cids) != len(out) {
+		return xerrors.Errorf("mismatched lengths of %d cids and %d outputs", len(cids), len(out))
+	}
+	s.mu.Lock()
+	blocks := make([][]byte, len(cids))
+	for i, c := range cids {
+		blocks[i] = s.blocks[c]
+	}
+	s.mu.Unlock()
+
+	for i, data := range blocks {
+		if data == nil {
+			return xerrors.Errorf("block %v: %w", cids[i], ErrNotFound)
+		}
+		um, ok := out[i].(cbor.Unmarshaler)
+		if !ok {
+			return xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", cids[i], out[i])
+		}
+		if err := um.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put serializes `v`, which must be a cbor.Marshaler, and stores the block, returning its CID.
+func (s *MemStore) Put(_ context.Context, v interface{}) (cid.Cid, error) {
+	m, ok := v.(cbor.Marshaler)
+	if !ok {
+		return cid.Undef, xerrors.Errorf("can't marshal %T, which is not a cbor.Marshaler", v)
+	}
+	var buf bytes.Buffer
+	if err := m.MarshalCBOR(&buf); err != nil {
+		return cid.Undef, xerrors.Errorf("failed to marshal %T: %w", v, err)
+	}
+	c, err := abi.CidBuilder.Sum(buf.Bytes())
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("failed to compute cid: %w", err)
+	}
+	s.mu.Lock()
+	s.blocks[c] = buf.Bytes()
+	s.mu.Unlock()
+	return c, nil
+}
+
+// Delete removes the block with CID `c`, if present.
+func (s *MemStore) Delete(_ context.Context, c cid.Cid) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blocks, c)
+	return nil
+}
+
+// Returns the number of blocks held by the store.
+func (s *MemStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.blocks)
+}
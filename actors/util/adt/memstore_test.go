@@ -0,0 +1,83 @@
+package adt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestMemStore(t *testing.T) {
+	store := adt.NewMemStore()
+	ctx := context.Background()
+
+	v := abi.NewTokenAmount(100)
+	c, err := store.Put(ctx, &v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+
+	var out abi.TokenAmount
+	require.NoError(t, store.Get(ctx, c, &out))
+	assert.Equal(t, v, out)
+
+	// Blocks are addressed as they are by the runtime and other stores.
+	other := ipld.NewADTStore(ctx)
+	otherCid, err := other.Put(ctx, &v)
+	require.NoError(t, err)
+	assert.Equal(t, otherCid, c)
+
+	// Putting the same value again stores nothing new.
+	_, err = store.Put(ctx, &v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+
+	err = store.Get(ctx, tutil.MakeCID("missing", nil), &out)
+	assert.True(t, xerrors.Is(err, adt.ErrNotFound))
+
+	// Values must be CBOR (un)marshalers.
+	_, err = store.Put(ctx, "string")
+	assert.Error(t, err)
+	var s string
+	assert.Error(t, store.Get(ctx, c, &s))
+
+	// Deleting removes the block, and deleting a missing block is not an error.
+	require.NoError(t, store.Delete(ctx, c))
+	assert.Equal(t, 0, store.Len())
+	assert.True(t, xerrors.Is(store.Get(ctx, c, &out), adt.ErrNotFound))
+	require.NoError(t, store.Delete(ctx, c))
+}
+
+func TestMemStoreCollections(t *testing.T) {
+	store := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for i := uint64(0); i < 100; i++ {
+		v := abi.NewTokenAmount(int64(i))
+		require.NoError(t, m.Put(abi.UIntKey(i), &v))
+	}
+
+	m, err = adt.AsMap(store, tutil.MustRoot(t, m), builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	var out abi.TokenAmount
+	found, err := m.Get(abi.UIntKey(42), &out)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, abi.NewTokenAmount(42), out)
+
+	arr, err := adt.MakeEmptyArray(store, 3)
+	require.NoError(t, err)
+	require.NoError(t, arr.Set(7, &out))
+	arr, err = adt.AsArray(store, tutil.MustRoot(t, arr), 3)
+	require.NoError(t, err)
+	found, err = arr.Get(7, &out)
+	require.NoError(t, err)
+	assert.True(t, found)
+}
@@ -67,7 +67,7 @@ func (mm *Multimap) Add(key abi.Keyer, value cbor.Marshaler) error {
 
 	// Append to the array.
 	if err = array.AppendContinuous(value); err != nil {
-		return errors.Wrapf(err, "failed to add multimap key %v value %v", key, value)
+		return errors.Wrapf(err, "failed to add multimap key %v", key)
 	}
 
 	c, err := array.Root()
@@ -84,12 +84,94 @@ func (mm *Multimap) Add(key abi.Keyer, value cbor.Marshaler) error {
 	return nil
 }
 
+// Sets the value at index `i` for a key, replacing any value already at that index.
+// This suits values addressed by an identifier chosen by the caller rather than by insertion order,
+// which can then be removed by the same index.
+func (mm *Multimap) Put(key abi.Keyer, i uint64, value cbor.Marshaler) error {
+	array, found, err := mm.Get(key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		array, err = MakeEmptyArray(mm.mp.store, mm.innerBitwidth)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = array.Set(i, value); err != nil {
+		return errors.Wrapf(err, "failed to set multimap key %v index %v", key, i)
+	}
+
+	c, err := array.Root()
+	if err != nil {
+		return xerrors.Errorf("failed to flush child array: %w", err)
+	}
+	newArrayRoot := cbg.CborCid(c)
+	if err := mm.mp.Put(key, &newArrayRoot); err != nil {
+		return errors.Wrapf(err, "failed to store multimap values")
+	}
+	return nil
+}
+
+// Removes the value at index `i` for a key, leaving the indices of its other values unchanged.
+// The key is removed from the outer map if it has no values remaining.
+// Returns whether a value was removed.
+func (mm *Multimap) Remove(key abi.Keyer, i uint64) (bool, error) {
+	array, found, err := mm.Get(key)
+	if err != nil || !found {
+		return false, err
+	}
+	if removed, err := array.TryDelete(i); err != nil {
+		return false, errors.Wrapf(err, "failed to remove multimap key %v index %v", key, i)
+	} else if !removed {
+		return false, nil
+	}
+
+	if array.Length() == 0 {
+		if err := mm.mp.Delete(key); err != nil {
+			return false, errors.Wrapf(err, "failed to delete emptied multimap key %v", key)
+		}
+		return true, nil
+	}
+
+	c, err := array.Root()
+	if err != nil {
+		return false, xerrors.Errorf("failed to flush child array: %w", err)
+	}
+	newArrayRoot := cbg.CborCid(c)
+	if err := mm.mp.Put(key, &newArrayRoot); err != nil {
+		return false, errors.Wrapf(err, "failed to store multimap values")
+	}
+	return true, nil
+}
+
 // Removes all values for a key.
 func (mm *Multimap) RemoveAll(key abi.Keyer) error {
-	if _, err := mm.mp.TryDelete(key); err != nil {
-		return errors.Wrapf(err, "failed to delete multimap key %v root %v", key, mm.mp.root)
+	_, err := mm.TryRemoveAll(key)
+	return err
+}
+
+// Removes all values for a key, deleting the key from the outer map.
+// Returns whether the key was previously present.
+func (mm *Multimap) TryRemoveAll(key abi.Keyer) (bool, error) {
+	found, err := mm.mp.TryDelete(key)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to delete multimap key %v root %v", key, mm.mp.lastCid)
 	}
-	return nil
+	return found, nil
+}
+
+// Returns the number of values stored for a key, which is zero if the key is absent.
+func (mm *Multimap) Count(key abi.Keyer) (uint64, error) {
+	array, found, err := mm.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, nil
+	}
+	return array.Length(), nil
 }
 
 // Iterates all entries for a key in the order they were inserted, deserializing each value in turn into `out` and then
@@ -107,6 +189,8 @@ func (mm *Multimap) ForEach(key abi.Keyer, out cbor.Unmarshaler, fn func(i int64
 	return nil
 }
 
+// Iterates all keys, calling a function with each key and its array of values.
+// Iteration halts if the function returns an error, and stops without error if it returns StopIteration.
 func (mm *Multimap) ForAll(fn func(k string, arr *Array) error) error {
 	var arrRoot cbg.CborCid
 	if err := mm.mp.ForEach(&arrRoot, func(k string) error {
@@ -123,6 +207,18 @@ func (mm *Multimap) ForAll(fn func(k string, arr *Array) error) error {
 	return nil
 }
 
+// Iterates all values for all keys, deserializing each value in turn into `out` and then calling a function
+// with its key and index. Values for each key are visited in the order they were inserted.
+// Iteration halts if the function returns an error, and stops without error if it returns StopIteration.
+// If the output parameter is nil, deserialization is skipped.
+func (mm *Multimap) ForAllValues(out cbor.Unmarshaler, fn func(k string, i int64) error) error {
+	return mm.ForAll(func(k string, arr *Array) error {
+		return arr.ForEach(out, func(i int64) error {
+			return fn(k, i)
+		})
+	})
+}
+
 func (mm *Multimap) Get(key abi.Keyer) (*Array, bool, error) {
 	var arrayRoot cbg.CborCid
 	found, err := mm.mp.Get(key, &arrayRoot)
@@ -0,0 +1,185 @@
+package adt_test
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/mock"
+)
+
+func TestMultimapRemoveAll(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	mm, err := adt.MakeEmptyMultimap(store, builtin.DefaultHamtBitwidth, 3)
+	require.NoError(t, err)
+
+	v := abi.NewTokenAmount(1)
+	require.NoError(t, mm.Add(abi.UIntKey(1), &v))
+	require.NoError(t, mm.Add(abi.UIntKey(1), &v))
+	require.NoError(t, mm.Add(abi.UIntKey(2), &v))
+
+	removed, err := mm.TryRemoveAll(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	// The key is removed entirely rather than left with an empty array.
+	_, found, err := mm.Get(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.False(t, found)
+	var keys []string
+	require.NoError(t, mm.ForAll(func(k string, arr *adt.Array) error {
+		keys = append(keys, k)
+		return nil
+	}))
+	assert.Equal(t, []string{abi.UIntKey(2).Key()}, keys)
+
+	// Removing a missing key reports nothing removed.
+	removed, err = mm.TryRemoveAll(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.False(t, removed)
+	require.NoError(t, mm.RemoveAll(abi.UIntKey(3)))
+}
+
+func TestMultimapCount(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	mm, err := adt.MakeEmptyMultimap(store, builtin.DefaultHamtBitwidth, 3)
+	require.NoError(t, err)
+
+	v := abi.NewTokenAmount(1)
+	require.NoError(t, mm.Add(abi.UIntKey(1), &v))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, mm.Add(abi.UIntKey(2), &v))
+	}
+
+	for _, tc := range []struct {
+		key   uint64
+		count uint64
+	}{{0, 0}, {1, 1}, {2, 100}} {
+		count, err := mm.Count(abi.UIntKey(tc.key))
+		require.NoError(t, err)
+		assert.Equal(t, tc.count, count)
+	}
+}
+
+func TestMultimapForAllValues(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	mm, err := adt.MakeEmptyMultimap(store, builtin.DefaultHamtBitwidth, 3)
+	require.NoError(t, err)
+
+	expected := map[string][]abi.TokenAmount{}
+	for k := uint64(0); k < 5; k++ {
+		for j := uint64(0); j <= k; j++ {
+			v := abi.NewTokenAmount(int64(k*10 + j))
+			require.NoError(t, mm.Add(abi.UIntKey(k), &v))
+			expected[abi.UIntKey(k).Key()] = append(expected[abi.UIntKey(k).Key()], v)
+		}
+	}
+
+	visited := map[string][]abi.TokenAmount{}
+	var out abi.TokenAmount
+	require.NoError(t, mm.ForAllValues(&out, func(k string, i int64) error {
+		assert.Equal(t, int64(len(visited[k])), i)
+		visited[k] = append(visited[k], out)
+		return nil
+	}))
+	assert.Equal(t, expected, visited)
+
+	// StopIteration from within an inner array ends the whole iteration.
+	count := 0
+	require.NoError(t, mm.ForAllValues(nil, func(k string, i int64) error {
+		count++
+		if count == 3 {
+			return adt.StopIteration
+		}
+		return nil
+	}))
+	assert.Equal(t, 3, count)
+}
+
+func TestMultimapRemove(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	mm, err := adt.MakeEmptyMultimap(store, builtin.DefaultHamtBitwidth, 3)
+	require.NoError(t, err)
+
+	for i := int64(0); i < 3; i++ {
+		v := abi.NewTokenAmount(i)
+		require.NoError(t, mm.Add(abi.UIntKey(1), &v))
+	}
+	v := abi.NewTokenAmount(10)
+	require.NoError(t, mm.Add(abi.UIntKey(2), &v))
+
+	removed, err := mm.Remove(abi.UIntKey(1), 1)
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	// Siblings keep their indices.
+	var indices []int64
+	var out abi.TokenAmount
+	require.NoError(t, mm.ForEach(abi.UIntKey(1), &out, func(i int64) error {
+		assert.Equal(t, abi.NewTokenAmount(i), out)
+		indices = append(indices, i)
+		return nil
+	}))
+	assert.Equal(t, []int64{0, 2}, indices)
+
+	// Missing indices and keys remove nothing.
+	removed, err = mm.Remove(abi.UIntKey(1), 1)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	removed, err = mm.Remove(abi.UIntKey(3), 0)
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	// Removing the last value removes the key.
+	removed, err = mm.Remove(abi.UIntKey(2), 0)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	_, found, err := mm.Get(abi.UIntKey(2))
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMultimapPut(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	mm, err := adt.MakeEmptyMultimap(store, builtin.DefaultHamtBitwidth, 3)
+	require.NoError(t, err)
+
+	for _, i := range []int64{100, 7, 4000} {
+		v := abi.NewTokenAmount(i)
+		require.NoError(t, mm.Put(abi.UIntKey(1), uint64(i), &v))
+	}
+	// Putting at an existing index replaces the value.
+	v := abi.NewTokenAmount(7)
+	require.NoError(t, mm.Put(abi.UIntKey(1), 7, &v))
+
+	// Values are visited in index order.
+	var indices []int64
+	var out abi.TokenAmount
+	require.NoError(t, mm.ForEach(abi.UIntKey(1), &out, func(i int64) error {
+		assert.Equal(t, abi.NewTokenAmount(i), out)
+		indices = append(indices, i)
+		return nil
+	}))
+	assert.Equal(t, []int64{7, 100, 4000}, indices)
+	count, err := mm.Count(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	// Values are removed by the index they were put at.
+	removed, err := mm.Remove(abi.UIntKey(1), 100)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	count, err = mm.Count(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+}
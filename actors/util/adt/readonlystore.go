@@ -0,0 +1,62 @@
+package adt
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Returned (wrapped) on an attempt to write to a read-only store.
+var ErrReadOnly = xerrors.New("store is read-only")
+
+// Creates a new Store passing reads through to `underlying`, but rejecting all writes.
+// Collections loaded from it may be read freely, but any attempt to flush a modification fails.
+// The store is a BatchStore exactly when the underlying store is, so collections read it just as they would
+// the underlying store. It's always a HasStore and a TryGetStore, falling back as Has and TryGet do.
+func NewReadOnlyStore(underlying Store) Store {
+	s := &readOnlyStore{underlying: underlying}
+	if _, ok := underlying.(BatchStore); ok {
+		return readOnlyBatchStore{s}
+	}
+	return s
+}
+
+type readOnlyStore struct {
+	underlying Store
+}
+
+var _ HasStore = (*readOnlyStore)(nil)
+var _ TryGetStore = (*readOnlyStore)(nil)
+
+func (s *readOnlyStore) Context() context.Context {
+	return s.underlying.Context()
+}
+
+func (s *readOnlyStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	return s.underlying.Get(ctx, c, out)
+}
+
+func (s *readOnlyStore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	return Has(ctx, s.underlying, c)
+}
+
+func (s *readOnlyStore) TryGet(ctx context.Context, c cid.Cid, out interface{}) (bool, error) {
+	return TryGet(ctx, s.underlying, c, out)
+}
+
+// Put always fails with an error wrapping ErrReadOnly.
+func (s *readOnlyStore) Put(_ context.Context, v interface{}) (cid.Cid, error) {
+	return cid.Undef, xerrors.Errorf("can't write %T: %w", v, ErrReadOnly)
+}
+
+// A read-only store over a BatchStore.
+type readOnlyBatchStore struct {
+	*readOnlyStore
+}
+
+var _ BatchStore = readOnlyBatchStore{}
+
+func (s readOnlyBatchStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	return s.underlying.(BatchStore).GetMany(ctx, cids, out)
+}
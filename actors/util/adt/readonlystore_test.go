@@ -0,0 +1,95 @@
+package adt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/mock"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestReadOnlyStore(t *testing.T) {
+	underlying := adt.NewMemStore()
+	m, err := adt.MakeEmptyMap(underlying, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	v := abi.NewTokenAmount(1)
+	require.NoError(t, m.Put(abi.UIntKey(1), &v))
+	root := tutil.MustRoot(t, m)
+	blocks := underlying.Len()
+
+	store := adt.NewReadOnlyStore(underlying)
+	_, err = store.Put(store.Context(), &v)
+	assert.True(t, xerrors.Is(err, adt.ErrReadOnly))
+
+	// Collections may be read.
+	m, err = adt.AsMap(store, root, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	var out abi.TokenAmount
+	found, err := m.Get(abi.UIntKey(1), &out)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, v, out)
+	found, err = adt.Has(store.Context(), store, root)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	// But modifications can't be flushed.
+	require.NoError(t, m.Put(abi.UIntKey(2), &v))
+	_, err = m.Root()
+	assert.True(t, xerrors.Is(err, adt.ErrReadOnly))
+	assert.Equal(t, blocks, underlying.Len())
+}
+
+func TestReadOnlyStoreCapabilities(t *testing.T) {
+	underlying := adt.NewMemStore()
+	v := abi.NewTokenAmount(1)
+	c, err := underlying.Put(underlying.Context(), &v)
+	require.NoError(t, err)
+
+	// Batch reads are available only from a batching underlying store.
+	store := adt.NewReadOnlyStore(underlying)
+	bs, ok := store.(adt.BatchStore)
+	require.True(t, ok)
+	var out abi.TokenAmount
+	require.NoError(t, bs.GetMany(store.Context(), []cid.Cid{c}, []interface{}{&out}))
+	assert.Equal(t, v, out)
+	_, ok = adt.NewReadOnlyStore(plainStore{underlying}).(adt.BatchStore)
+	assert.False(t, ok)
+
+	// Deletes are never available.
+	_, ok = store.(adt.DeleteStore)
+	assert.False(t, ok)
+}
+
+func TestRuntimeReadOnlyStore(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	v := abi.NewTokenAmount(1)
+	c, err := adt.AsStore(rt).Put(context.Background(), &v)
+	require.NoError(t, err)
+
+	store := adt.AsReadOnlyStore(rt)
+	var out abi.TokenAmount
+	require.NoError(t, store.Get(store.Context(), c, &out))
+	assert.Equal(t, v, out)
+
+	_, err = store.Put(store.Context(), &v)
+	assert.True(t, xerrors.Is(err, adt.ErrReadOnly))
+
+	// The runtime reads blocks one at a time, so collections read through this store do too.
+	_, ok := store.(adt.BatchStore)
+	assert.False(t, ok)
+
+	// Optional reads reach the runtime without aborting on a miss.
+	found, err := adt.TryGet(store.Context(), store, tutil.MakeCID("missing", nil), &out)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -3,6 +3,7 @@ package adt
 import (
 	"github.com/filecoin-project/go-state-types/abi"
 	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
 )
 
 // Set interprets a Map as a set, storing keys (with empty values) in a HAMT.
@@ -33,6 +34,21 @@ func MakeEmptySet(s Store, bitwidth int) (*Set, error) {
 	return &Set{m}, nil
 }
 
+// Creates a new set holding the given keys, with branching factor 2^bitwidth.
+// Duplicate keys are added just once. The keys are not written to the store until Root is called.
+func SetFromSlice(s Store, bitwidth int, keys []abi.Keyer) (*Set, error) {
+	set, err := MakeEmptySet(s, bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if err := set.Put(k); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
 // Root return the root cid of HAMT.
 func (h *Set) Root() (cid.Cid, error) {
 	return h.m.Root()
@@ -43,9 +59,16 @@ func (h *Set) Put(k abi.Keyer) error {
 	return h.m.Put(k, nil)
 }
 
+// Adds `k` to the set iff it is not already present.
+// Returns whether the key was newly added.
+func (h *Set) PutIfAbsent(k abi.Keyer) (bool, error) {
+	return h.m.PutIfAbsent(k, nil)
+}
+
 // Has returns true iff `k` is in the set.
+// Set members have no values to deserialize, so this only loads the nodes on the path to `k`.
 func (h *Set) Has(k abi.Keyer) (bool, error) {
-	return h.m.Get(k, nil)
+	return h.m.Has(k)
 }
 
 // Removes `k` from the set, if present.
@@ -65,7 +88,77 @@ func (h *Set) ForEach(cb func(k string) error) error {
 	return h.m.ForEach(nil, cb)
 }
 
+// Returns the number of keys in the set.
+// This traverses the whole HAMT.
+func (h *Set) Count() (uint64, error) {
+	return h.m.Count()
+}
+
 // Collects all the keys from the set into a slice of strings.
 func (h *Set) CollectKeys() (out []string, err error) {
 	return h.m.CollectKeys()
 }
+
+// Collects all the keys from the set, each converted to a Keyer with `parse`.
+// Keys are returned in HAMT traversal order.
+func (h *Set) ToSlice(parse func(k string) (abi.Keyer, error)) ([]abi.Keyer, error) {
+	var out []abi.Keyer
+	err := h.ForEach(func(k string) error {
+		key, err := parse(k)
+		if err != nil {
+			return xerrors.Errorf("failed to parse key %x: %w", k, err)
+		}
+		out = append(out, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Returns a new set holding the keys present in either this set or `other`.
+// The result is built from a copy of this set, walking only `other`, so it's cheapest to call on the larger set.
+func (h *Set) Union(other *Set) (*Set, error) {
+	result := &Set{h.m.Copy()}
+	if err := other.ForEach(func(k string) error {
+		return result.Put(stringKey(k))
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to union sets: %w", err)
+	}
+	return result, nil
+}
+
+// Returns a new set holding the keys present in both this set and `other`.
+// The result is built by walking this set, so it's cheapest to call on the smaller set.
+func (h *Set) Intersect(other *Set) (*Set, error) {
+	return h.filter(other, true)
+}
+
+// Returns a new set holding the keys present in this set but not in `other`.
+// The result is built by walking this set.
+func (h *Set) Difference(other *Set) (*Set, error) {
+	return h.filter(other, false)
+}
+
+// Returns a new set, with the same bitwidth as this one, holding the keys of this set for which
+// membership in `other` is `inOther`.
+func (h *Set) filter(other *Set, inOther bool) (*Set, error) {
+	result, err := MakeEmptySet(h.m.store, h.m.bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.ForEach(func(k string) error {
+		found, err := other.Has(stringKey(k))
+		if err != nil {
+			return err
+		}
+		if found == inOther {
+			return result.Put(stringKey(k))
+		}
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("failed to filter set: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,230 @@
+package adt_test
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/mock"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestSetHas(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	set, err := adt.MakeEmptySet(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	miner := tutil.NewIDAddr(t, 101)
+	found, err := set.Has(abi.AddrKey(miner))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, set.Put(abi.AddrKey(miner)))
+	found, err = set.Has(abi.AddrKey(miner))
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = set.Has(abi.AddrKey(tutil.NewIDAddr(t, 102)))
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestSetPutIfAbsent(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	set, err := adt.MakeEmptySet(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+
+	added, err := set.PutIfAbsent(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.True(t, added)
+	root := tutil.MustRoot(t, set)
+
+	// Adding again reports the key was already present and leaves the set unchanged.
+	added, err = set.PutIfAbsent(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, root, tutil.MustRoot(t, set))
+
+	found, err := set.Has(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestSetTryDelete(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	set, err := adt.MakeEmptySet(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	require.NoError(t, set.Put(abi.UIntKey(1)))
+	require.NoError(t, set.Put(abi.UIntKey(2)))
+	root := tutil.MustRoot(t, set)
+
+	// Deleting an absent key reports false and leaves the root unchanged.
+	deleted, err := set.TryDelete(abi.UIntKey(3))
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Equal(t, root, tutil.MustRoot(t, set))
+
+	deleted, err = set.TryDelete(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.NotEqual(t, root, tutil.MustRoot(t, set))
+
+	found, err := set.Has(abi.UIntKey(1))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Strict delete of the now absent key fails.
+	assert.Error(t, set.Delete(abi.UIntKey(1)))
+}
+
+func TestSetCount(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	// A narrow bitwidth forces a multi-level HAMT.
+	set, err := adt.MakeEmptySet(store, 2)
+	require.NoError(t, err)
+
+	count, err := set.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	for i := uint64(0); i < 100; i++ {
+		require.NoError(t, set.Put(abi.UIntKey(i)))
+	}
+	// Repeated puts don't change the count.
+	require.NoError(t, set.Put(abi.UIntKey(7)))
+	count, err = set.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), count)
+
+	set, err = adt.AsSet(store, tutil.MustRoot(t, set), 2)
+	require.NoError(t, err)
+	require.NoError(t, set.Delete(abi.UIntKey(7)))
+	count, err = set.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(99), count)
+}
+
+func TestSetOperations(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	makeSet := func(keys ...uint64) *adt.Set {
+		set, err := adt.MakeEmptySet(store, builtin.DefaultHamtBitwidth)
+		require.NoError(t, err)
+		for _, k := range keys {
+			require.NoError(t, set.Put(abi.UIntKey(k)))
+		}
+		return set
+	}
+	assertSet := func(expected, actual *adt.Set) {
+		assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, actual))
+	}
+
+	t.Run("overlapping", func(t *testing.T) {
+		a := makeSet(1, 2, 3, 4)
+		b := makeSet(3, 4, 5)
+		aRoot, bRoot := tutil.MustRoot(t, a), tutil.MustRoot(t, b)
+
+		union, err := a.Union(b)
+		require.NoError(t, err)
+		assertSet(makeSet(1, 2, 3, 4, 5), union)
+
+		intersection, err := a.Intersect(b)
+		require.NoError(t, err)
+		assertSet(makeSet(3, 4), intersection)
+
+		difference, err := a.Difference(b)
+		require.NoError(t, err)
+		assertSet(makeSet(1, 2), difference)
+		difference, err = b.Difference(a)
+		require.NoError(t, err)
+		assertSet(makeSet(5), difference)
+
+		// The operands are unchanged, and mutating a result doesn't affect them.
+		require.NoError(t, union.Put(abi.UIntKey(6)))
+		assert.Equal(t, aRoot, tutil.MustRoot(t, a))
+		assert.Equal(t, bRoot, tutil.MustRoot(t, b))
+	})
+
+	t.Run("one empty", func(t *testing.T) {
+		a := makeSet(1, 2)
+		empty := makeSet()
+
+		union, err := a.Union(empty)
+		require.NoError(t, err)
+		assertSet(a, union)
+		union, err = empty.Union(a)
+		require.NoError(t, err)
+		assertSet(a, union)
+
+		intersection, err := a.Intersect(empty)
+		require.NoError(t, err)
+		assertSet(empty, intersection)
+
+		difference, err := a.Difference(empty)
+		require.NoError(t, err)
+		assertSet(a, difference)
+		difference, err = empty.Difference(a)
+		require.NoError(t, err)
+		assertSet(empty, difference)
+	})
+
+	t.Run("identical", func(t *testing.T) {
+		a := makeSet(1, 2, 3)
+		b := makeSet(1, 2, 3)
+
+		union, err := a.Union(b)
+		require.NoError(t, err)
+		assertSet(a, union)
+
+		intersection, err := a.Intersect(b)
+		require.NoError(t, err)
+		assertSet(a, intersection)
+
+		difference, err := a.Difference(b)
+		require.NoError(t, err)
+		assertSet(makeSet(), difference)
+	})
+}
+
+func TestSetSliceConversion(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	addrs := []address.Address{tutil.NewIDAddr(t, 100), tutil.NewIDAddr(t, 101), tutil.NewIDAddr(t, 102)}
+	keys := []abi.Keyer{abi.AddrKey(addrs[0]), abi.AddrKey(addrs[1]), abi.AddrKey(addrs[2]), abi.AddrKey(addrs[0])}
+
+	set, err := adt.SetFromSlice(store, builtin.DefaultHamtBitwidth, keys)
+	require.NoError(t, err)
+	count, err := set.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	// Same as a set built up one key at a time.
+	expected, err := adt.MakeEmptySet(store, builtin.DefaultHamtBitwidth)
+	require.NoError(t, err)
+	for _, a := range addrs {
+		require.NoError(t, expected.Put(abi.AddrKey(a)))
+	}
+	assert.Equal(t, tutil.MustRoot(t, expected), tutil.MustRoot(t, set))
+
+	members, err := set.ToSlice(func(k string) (abi.Keyer, error) {
+		a, err := adt.ParseAddrKey(k)
+		return abi.AddrKey(a), err
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, keys[:3], members)
+
+	// Parse errors are propagated.
+	failure := xerrors.New("failure")
+	_, err = set.ToSlice(func(k string) (abi.Keyer, error) { return nil, failure })
+	assert.True(t, xerrors.Is(err, failure))
+}
@@ -8,12 +8,95 @@ import (
 	adt2 "github.com/filecoin-project/specs-actors/v2/actors/util/adt"
 	cid "github.com/ipfs/go-cid"
 	ipldcbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 
 	vmr "github.com/filecoin-project/specs-actors/v5/actors/runtime"
 )
 
 type Store = adt2.Store
 
+// BatchStore is an optional extension of Store, for stores able to retrieve many blocks more efficiently than
+// one at a time, such as those with a networked backend.
+type BatchStore interface {
+	Store
+	// Deserializes the blocks with CIDs `cids` into the corresponding elements of `out`, which must be the same length.
+	GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error
+}
+
+// Retrieves many blocks from a store, as a batch if the store is a BatchStore and otherwise one at a time.
+func GetMany(ctx context.Context, s Store, cids []cid.Cid, out []interface{}) error {
+	if len(cids) != len(out) {
+		return xerrors.Errorf("mismatched lengths of %d cids and %d outputs", len(cids), len(out))
+	}
+	if bs, ok := s.(BatchStore); ok {
+		return bs.GetMany(ctx, cids, out)
+	}
+	for i, c := range cids {
+		if err := s.Get(ctx, c, out[i]); err != nil {
+			return xerrors.Errorf("failed to get block %v: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// HasStore is an optional extension of Store, for stores able to check for a block without retrieving it.
+type HasStore interface {
+	Store
+	// Returns whether the store holds the block with CID `c`.
+	Has(ctx context.Context, c cid.Cid) (bool, error)
+}
+
+// Returns whether a store holds the block with CID `c`.
+// If the store is not a HasStore, this retrieves the block without decoding it, treating an error wrapping
+// ErrNotFound as absence. Other errors, including misses reported by stores that don't wrap ErrNotFound,
+// are returned.
+func Has(ctx context.Context, s Store, c cid.Cid) (bool, error) {
+	if hs, ok := s.(HasStore); ok {
+		return hs.Has(ctx, c)
+	}
+	var raw cbg.Deferred
+	if err := s.Get(ctx, c, &raw); err != nil {
+		if xerrors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, xerrors.Errorf("failed to check for block %v: %w", c, err)
+	}
+	return true, nil
+}
+
+// DeleteStore is an optional extension of Store, for stores that own their blocks and so may discard those
+// no longer referenced. The runtime's store is append-only, and is never a DeleteStore.
+type DeleteStore interface {
+	Store
+	// Removes the block with CID `c`, if present.
+	Delete(ctx context.Context, c cid.Cid) error
+}
+
+// TryGetStore is an optional extension of Store, for stores whose Get doesn't return a missing block as an error
+// wrapping ErrNotFound, such as the runtime's store, which aborts.
+type TryGetStore interface {
+	Store
+	// Deserializes the block with CID `c` into `out` if present. Returns whether the block was found.
+	TryGet(ctx context.Context, c cid.Cid, out interface{}) (bool, error)
+}
+
+// Retrieves the block with CID `c` into `out` if present, returning whether it was found.
+// This suits lookups that may legitimately miss: where the store is a TryGetStore a miss never aborts,
+// and otherwise an error wrapping ErrNotFound is treated as absence.
+func TryGet(ctx context.Context, s Store, c cid.Cid, out interface{}) (bool, error) {
+	if ts, ok := s.(TryGetStore); ok {
+		return ts.TryGet(ctx, c, out)
+	}
+	if err := s.Get(ctx, c, out); err != nil {
+		if xerrors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // Adapts a vanilla IPLD store as an ADT store.
 func WrapStore(ctx context.Context, store ipldcbor.IpldStore) Store {
 	return &wstore{
@@ -45,27 +128,61 @@ func AsStore(rt vmr.Runtime) Store {
 	return rtStore{rt}
 }
 
+// Adapts a Runtime as an ADT store rejecting writes, for methods that only read state.
+// Reads behave exactly as with AsStore, including aborting on a missing block.
+func AsReadOnlyStore(rt vmr.Runtime) Store {
+	return NewReadOnlyStore(AsStore(rt))
+}
+
 type rtStore struct {
 	vmr.Runtime
 }
 
-var _ Store = &rtStore{}
+var _ HasStore = &rtStore{}
+var _ TryGetStore = &rtStore{}
 
 func (r rtStore) Context() context.Context {
 	return r.Runtime.Context()
 }
 
+// Get deserializes the block with CID `c` into `out`.
+// A missing block aborts the actor with exit code ErrNotFound. Actors' exit codes on a missing block are part of
+// consensus, so this doesn't return an error that callers would instead abort on with their own exit codes.
+// Use TryGet for a lookup that may legitimately miss.
 func (r rtStore) Get(_ context.Context, c cid.Cid, out interface{}) error {
 	// The Go context is (un/fortunately?) dropped here.
 	// See https://github.com/filecoin-project/specs-actors/issues/140
-	if !r.StoreGet(c, out.(cbor.Unmarshaler)) {
+	um, ok := out.(cbor.Unmarshaler)
+	if !ok {
+		return xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", c, out)
+	}
+	if !r.StoreGet(c, um) {
 		r.Abortf(exitcode.ErrNotFound, "not found")
 	}
 	return nil
 }
 
+// TryGet deserializes the block with CID `c` into `out` if present, without aborting on a miss.
+func (r rtStore) TryGet(_ context.Context, c cid.Cid, out interface{}) (bool, error) {
+	um, ok := out.(cbor.Unmarshaler)
+	if !ok {
+		return false, xerrors.Errorf("can't unmarshal block %v into %T, which is not a cbor.Unmarshaler", c, out)
+	}
+	return r.StoreGet(c, um), nil
+}
+
+// Has checks for a block by loading it without decoding.
+func (r rtStore) Has(_ context.Context, c cid.Cid) (bool, error) {
+	var raw cbg.Deferred
+	return r.StoreGet(c, &raw), nil
+}
+
 func (r rtStore) Put(_ context.Context, v interface{}) (cid.Cid, error) {
 	// The Go context is (un/fortunately?) dropped here.
 	// See https://github.com/filecoin-project/specs-actors/issues/140
-	return r.StorePut(v.(cbor.Marshaler)), nil
+	m, ok := v.(cbor.Marshaler)
+	if !ok {
+		return cid.Undef, xerrors.Errorf("can't marshal %T, which is not a cbor.Marshaler", v)
+	}
+	return r.StorePut(m), nil
 }
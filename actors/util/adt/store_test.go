@@ -0,0 +1,263 @@
+package adt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v5/actors/runtime"
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/v5/support/ipld"
+	"github.com/filecoin-project/specs-actors/v5/support/mock"
+	tutil "github.com/filecoin-project/specs-actors/v5/support/testing"
+)
+
+func TestGetMany(t *testing.T) {
+	ctx := context.Background()
+	putValues := func(store adt.Store, n int) []cid.Cid {
+		var cids []cid.Cid
+		for i := 0; i < n; i++ {
+			v := abi.NewTokenAmount(int64(i))
+			c, err := store.Put(ctx, &v)
+			require.NoError(t, err)
+			cids = append(cids, c)
+		}
+		return cids
+	}
+	outputs := func(n int) ([]interface{}, []abi.TokenAmount) {
+		values := make([]abi.TokenAmount, n)
+		out := make([]interface{}, n)
+		for i := range values {
+			out[i] = &values[i]
+		}
+		return out, values
+	}
+
+	stores := map[string]func() adt.Store{
+		"plain store":   func() adt.Store { return ipld.NewADTStore(ctx) },
+		"mem store":     func() adt.Store { return adt.NewMemStore() },
+		"caching store": func() adt.Store { return adt.NewCachingStore(&batchCountingStore{Store: adt.NewMemStore()}, 2) },
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore()
+			cids := putValues(store, 5)
+			out, values := outputs(5)
+			// Reverse order, with a repeat.
+			cids[0], cids[4] = cids[4], cids[0]
+			cids[3] = cids[1]
+			require.NoError(t, adt.GetMany(context.Background(), store, cids, out))
+			expected := []abi.TokenAmount{abi.NewTokenAmount(4), abi.NewTokenAmount(1), abi.NewTokenAmount(2),
+				abi.NewTokenAmount(1), abi.NewTokenAmount(0)}
+			assert.Equal(t, expected, values)
+
+			out, _ = outputs(2)
+			err := adt.GetMany(context.Background(), store, []cid.Cid{cids[0], tutil.MakeCID("missing", nil)}, out)
+			assert.Error(t, err)
+			assert.Error(t, adt.GetMany(context.Background(), store, cids, out))
+		})
+	}
+
+	t.Run("caching store batches misses", func(t *testing.T) {
+		underlying := &batchCountingStore{Store: adt.NewMemStore()}
+		cids := putValues(underlying, 4)
+		store := adt.NewCachingStore(underlying, 0)
+		var v abi.TokenAmount
+		require.NoError(t, store.Get(ctx, cids[0], &v))
+
+		out, values := outputs(4)
+		require.NoError(t, adt.GetMany(context.Background(), store, cids, out))
+		assert.Equal(t, abi.NewTokenAmount(3), values[3])
+		assert.Equal(t, 1, underlying.batches)
+		assert.Equal(t, 3, underlying.batched)
+
+		// All now cached.
+		require.NoError(t, adt.GetMany(context.Background(), store, cids, out))
+		assert.Equal(t, 1, underlying.batches)
+	})
+}
+
+// A BatchStore recording the batches it serves.
+type batchCountingStore struct {
+	adt.Store
+	batches int
+	batched int
+}
+
+func (s *batchCountingStore) GetMany(ctx context.Context, cids []cid.Cid, out []interface{}) error {
+	s.batches++
+	s.batched += len(cids)
+	for i, c := range cids {
+		if err := s.Get(ctx, c, out[i]); err != nil {
+			return xerrors.Errorf("failed to get %v: %w", c, err)
+		}
+	}
+	return nil
+}
+
+func TestRuntimeStoreGetNotFound(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+	missing := tutil.MakeCID("missing", nil)
+
+	// A miss aborts with the not-found exit code, from the store or from collections loading the block.
+	var out abi.TokenAmount
+	rt.ExpectAbort(exitcode.ErrNotFound, func() {
+		rt.Call(func(rt runtime.Runtime, _ *abi.EmptyValue) *abi.EmptyValue {
+			_ = store.Get(store.Context(), missing, &out)
+			return nil
+		}, nil)
+	})
+	rt.ExpectAbort(exitcode.ErrNotFound, func() {
+		rt.Call(func(rt runtime.Runtime, _ *abi.EmptyValue) *abi.EmptyValue {
+			_, _ = adt.AsMap(store, missing, builtin.DefaultHamtBitwidth)
+			return nil
+		}, nil)
+	})
+
+	// An optional lookup reports the miss instead, without aborting the calling actor.
+	rt.Call(func(rt runtime.Runtime, _ *abi.EmptyValue) *abi.EmptyValue {
+		found, err := adt.TryGet(store.Context(), store, missing, &out)
+		require.NoError(t, err)
+		assert.False(t, found)
+		return nil
+	}, nil)
+
+	v := abi.NewTokenAmount(7)
+	c, err := store.Put(store.Context(), &v)
+	require.NoError(t, err)
+	found, err := adt.TryGet(store.Context(), store, c, &out)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, v, out)
+}
+
+func TestTryGet(t *testing.T) {
+	store := adt.NewMemStore()
+	v := abi.NewTokenAmount(7)
+	c, err := store.Put(store.Context(), &v)
+	require.NoError(t, err)
+
+	var out abi.TokenAmount
+	found, err := adt.TryGet(store.Context(), store, c, &out)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, v, out)
+
+	found, err = adt.TryGet(store.Context(), store, tutil.MakeCID("missing", nil), &out)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Other errors are returned.
+	var s string
+	_, err = adt.TryGet(store.Context(), store, c, &s)
+	assert.Error(t, err)
+}
+
+func TestRuntimeStoreRejectsNonCBORValues(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	store := adt.AsStore(rt)
+
+	_, err := store.Put(store.Context(), struct{ X int }{1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "struct { X int }")
+
+	v := abi.NewTokenAmount(1)
+	c, err := store.Put(store.Context(), &v)
+	require.NoError(t, err)
+	var out []string
+	err = store.Get(store.Context(), c, &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "*[]string")
+}
+
+func TestHas(t *testing.T) {
+	rt := mock.NewBuilder(address.Undef).Build(t)
+	stores := map[string]adt.Store{
+		"runtime store":  adt.AsStore(rt),
+		"mem store":      adt.NewMemStore(),
+		"buffered store": adt.NewBufferedStore(adt.NewMemStore()),
+		"caching store":  adt.NewCachingStore(adt.NewMemStore(), 0),
+		// Falls back to retrieving the block.
+		"plain store": plainStore{adt.NewMemStore()},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			v := abi.NewTokenAmount(1)
+			c, err := store.Put(store.Context(), &v)
+			require.NoError(t, err)
+
+			found, err := adt.Has(context.Background(), store, c)
+			require.NoError(t, err)
+			assert.True(t, found)
+			found, err = adt.Has(context.Background(), store, tutil.MakeCID("missing", nil))
+			require.NoError(t, err)
+			assert.False(t, found)
+		})
+	}
+
+	t.Run("buffered and caching stores check the underlying store", func(t *testing.T) {
+		underlying := adt.NewMemStore()
+		v := abi.NewTokenAmount(1)
+		c, err := underlying.Put(underlying.Context(), &v)
+		require.NoError(t, err)
+		for _, store := range []adt.Store{adt.NewBufferedStore(underlying), adt.NewCachingStore(underlying, 0)} {
+			found, err := adt.Has(context.Background(), store, c)
+			require.NoError(t, err)
+			assert.True(t, found)
+		}
+	})
+}
+
+// Hides any optional store interfaces.
+type plainStore struct {
+	adt.Store
+}
+
+func TestStoreWrappersPassContext(t *testing.T) {
+	underlying := adt.NewMemStore()
+	v := abi.NewTokenAmount(1)
+	c, err := underlying.Put(underlying.Context(), &v)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checked := contextStore{plainStore{underlying}}
+	wrappers := map[string]adt.Store{
+		"read-only store":    adt.NewReadOnlyStore(checked),
+		"instrumented store": adt.NewInstrumentedStore(checked),
+		"buffered store":     adt.NewBufferedStore(checked),
+		"caching store":      adt.NewCachingStore(checked, 0),
+	}
+	for name, store := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			_, err := adt.Has(ctx, store, c)
+			assert.True(t, xerrors.Is(err, context.Canceled), err)
+			if _, ok := store.(adt.BatchStore); ok {
+				var out abi.TokenAmount
+				err = adt.GetMany(ctx, store, []cid.Cid{c}, []interface{}{&out})
+				assert.True(t, xerrors.Is(err, context.Canceled), err)
+			}
+		})
+	}
+}
+
+// Fails reads made with a done context.
+type contextStore struct {
+	adt.Store
+}
+
+func (s contextStore) Get(ctx context.Context, c cid.Cid, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Get(ctx, c, out)
+}
@@ -0,0 +1,178 @@
+// Command typedmap generates a strongly typed wrapper around adt.Map for a single key and value type.
+//
+// It is intended to be invoked via go:generate from the package declaring the value type, e.g.
+//
+//	//go:generate go run github.com/filecoin-project/specs-actors/v5/gen/typedmap -type=Transaction
+//
+// which writes a TransactionMap type, keyed by any abi.Keyer, to transactionmap_gen.go.
+// The value type must be one whose pointer implements both cbor.Marshaler and cbor.Unmarshaler, and the key
+// type must implement abi.Keyer. Values are passed and returned by value; only typed methods are exposed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+)
+
+var tmpl = template.Must(template.New("typedmap").Parse(`// Code generated by github.com/filecoin-project/specs-actors/v5/gen/typedmap. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- if .ImportAbi}}
+	"github.com/filecoin-project/go-state-types/abi"
+{{- end}}
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/specs-actors/v5/actors/util/adt"
+)
+
+// A specialization of a map of {{.Key}} to {{.Type}}.
+type {{.Name}} struct {
+	m *adt.Map
+}
+
+// Interprets a store as a map of {{.Type}} with root ` + "`r`" + `.
+// The HAMT is interpreted with branching factor 2^bitwidth.
+func As{{.Name}}(s adt.Store, r cid.Cid, bitwidth int) (*{{.Name}}, error) {
+	m, err := adt.AsMap(s, r, bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	return &{{.Name}}{m}, nil
+}
+
+// Creates a new map of {{.Type}} backed by an empty HAMT.
+func MakeEmpty{{.Name}}(s adt.Store, bitwidth int) (*{{.Name}}, error) {
+	m, err := adt.MakeEmptyMap(s, bitwidth)
+	if err != nil {
+		return nil, err
+	}
+	return &{{.Name}}{m}, nil
+}
+
+// Returns the root cid of underlying HAMT.
+func (t *{{.Name}}) Root() (cid.Cid, error) {
+	return t.m.Root()
+}
+
+// Gets the value for a key, returning whether it was found.
+// The value is zero if not found.
+func (t *{{.Name}}) Get(k {{.Key}}) ({{.Type}}, bool, error) {
+	var value {{.Type}}
+	found, err := t.m.Get(k, &value)
+	if err != nil || !found {
+		var zero {{.Type}}
+		return zero, found, err // The errors from Map carry good information, no need to wrap here.
+	}
+	return value, true, nil
+}
+
+// Checks for the existence of a key without deserializing its value.
+func (t *{{.Name}}) Has(k {{.Key}}) (bool, error) {
+	return t.m.Has(k)
+}
+
+// Sets the value for a key.
+func (t *{{.Name}}) Put(k {{.Key}}, value {{.Type}}) error {
+	return t.m.Put(k, &value)
+}
+
+// Removes the value for a key, expecting it to exist.
+func (t *{{.Name}}) Delete(k {{.Key}}) error {
+	return t.m.Delete(k)
+}
+
+// Removes the value for a key, if it exists. Returns whether the key was previously present.
+func (t *{{.Name}}) TryDelete(k {{.Key}}) (bool, error) {
+	return t.m.TryDelete(k)
+}
+
+// Removes the value for a key, returning it and whether it was previously present.
+// The value is zero if not found.
+func (t *{{.Name}}) Pop(k {{.Key}}) ({{.Type}}, bool, error) {
+	var value {{.Type}}
+	found, err := t.m.Pop(k, &value)
+	if err != nil || !found {
+		var zero {{.Type}}
+		return zero, found, err
+	}
+	return value, true, nil
+}
+
+// Iterates all entries in the map, calling a function with each key and value in turn.
+// Iteration halts if the function returns an error, which is returned unless it is adt.StopIteration.
+func (t *{{.Name}}) ForEach(fn func(key string, value {{.Type}}) error) error {
+	var value {{.Type}}
+	return t.m.ForEach(&value, func(key string) error {
+		return fn(key, value)
+	})
+}
+`))
+
+type params struct {
+	Package   string
+	Name      string
+	Type      string
+	Key       string
+	ImportAbi bool
+}
+
+func main() {
+	typ := flag.String("type", "", "name of the value type (required)")
+	key := flag.String("key", "abi.Keyer", "key type, which must implement abi.Keyer")
+	name := flag.String("name", "", "name of the generated map type (default <type>Map)")
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	out := flag.String("out", "", "output file (default <name>_gen.go, lower case)")
+	flag.Parse()
+
+	if *typ == "" || *pkg == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	p := params{
+		Package:   *pkg,
+		Name:      *name,
+		Type:      *typ,
+		Key:       *key,
+		ImportAbi: strings.HasPrefix(*key, "abi."),
+	}
+	if p.Name == "" {
+		p.Name = p.Type + "Map"
+	}
+	if *out == "" {
+		*out = strings.ToLower(p.Name) + "_gen.go"
+	}
+
+	if err := generate(p, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "typedmap: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(p params, out string) error {
+	src, err := render(p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
+
+// Renders and formats the source of a typed map.
+func render(p params) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return src, nil
+}
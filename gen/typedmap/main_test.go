@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The multisig actor's generated transaction map must match the current template. The build compiles it.
+func TestGeneratedTransactionMapIsCurrent(t *testing.T) {
+	expected, err := ioutil.ReadFile("../../actors/builtin/multisig/transactionmap_gen.go")
+	require.NoError(t, err)
+
+	src, err := render(params{
+		Package:   "multisig",
+		Name:      "TransactionMap",
+		Type:      "Transaction",
+		Key:       "abi.Keyer",
+		ImportAbi: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(src), "regenerate with go generate ./actors/builtin/multisig")
+}
+
+func TestRenderConcreteKey(t *testing.T) {
+	src, err := render(params{Package: "power", Name: "ClaimMap", Type: "Claim", Key: "abi.AddrKey", ImportAbi: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(src), "func (t *ClaimMap) Get(k abi.AddrKey) (Claim, bool, error) {")
+	assert.Contains(t, string(src), "func (t *ClaimMap) Put(k abi.AddrKey, value Claim) error {")
+	// The underlying map is not exposed.
+	assert.Contains(t, string(src), "\tm *adt.Map\n")
+	assert.NotContains(t, string(src), "\t*adt.Map\n")
+}
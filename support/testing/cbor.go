@@ -0,0 +1,29 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/cbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xorcare/golden"
+)
+
+// Asserts that the CBOR serialization of `v` matches the test's golden file, and that the serialization
+// unmarshals to a value equal to `v`. The value is unmarshalled into a new instance of the type pointed to by `v`.
+// Golden files hold the serialization in hex, in testdata/<test name>.golden, and are regenerated
+// by running the test with the -update flag.
+func AssertCBORRoundTrip(t *testing.T, v cbor.Marshaler) {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, v.MarshalCBOR(&buf))
+	golden.Assert(t, []byte(hex.EncodeToString(buf.Bytes())+"\n"))
+
+	out, ok := reflect.New(reflect.TypeOf(v).Elem()).Interface().(cbor.Unmarshaler)
+	require.True(t, ok, "%T is not a pointer to a cbor.Unmarshaler", v)
+	require.NoError(t, out.UnmarshalCBOR(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, v, out)
+}